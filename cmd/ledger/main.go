@@ -0,0 +1,65 @@
+// Команда ledger обслуживает главную книгу кошельков.
+//
+//	ledger verify   - сверяет книгу: суммы проводок по валютам и журналам равны нулю,
+//	                  балансы кошельков совпадают с остатками счетов. Код выхода 1 при расхождениях
+//	ledger rebuild  - пересчитывает балансы кошельков по книге
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/config"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/storages/postgres"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 2 || (os.Args[1] != "verify" && os.Args[1] != "rebuild") {
+		fmt.Fprintln(os.Stderr, "usage: ledger verify|rebuild")
+		os.Exit(2)
+	}
+
+	logger := logging.New()
+	defer logger.Sync()
+
+	cfg, err := config.LoadConfig(config.File())
+	if err != nil {
+		logger.Fatal("Failed to load config", zap.Error(err))
+	}
+
+	ctx := context.Background()
+
+	psql := postgres.NewPSQL(logger)
+	if err := psql.Start(ctx, cfg.Postgres); err != nil {
+		logger.Fatal("Failed to initialize PostgreSQL", zap.Error(err))
+	}
+	defer psql.Stop()
+
+	if os.Args[1] == "rebuild" {
+		if err := psql.RebuildBalances(ctx); err != nil {
+			logger.Fatal("Failed to rebuild balances", zap.Error(err))
+		}
+	}
+
+	report, err := psql.VerifyLedger(ctx)
+	if err != nil {
+		logger.Fatal("Failed to verify ledger", zap.Error(err))
+	}
+
+	for _, t := range report.Totals {
+		fmt.Printf("%s\tsum=%s\n", t.Currency, t.Sum)
+	}
+	fmt.Printf("unbalanced journals: %d\n", report.UnbalancedJournals)
+	for _, m := range report.Mismatches {
+		fmt.Printf("mismatch wallet=%s currency=%s balance=%s ledger=%s\n", m.WalletUUID, m.Currency, m.Balance, m.Ledger)
+	}
+
+	if !report.OK() {
+		fmt.Println("ledger verification FAILED")
+		psql.Stop()
+		os.Exit(1)
+	}
+	fmt.Println("ledger OK")
+}
@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
-	pb "github.com/galkin09/proto-exchange/exchange"
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"gw-currency-wallet/internal/app"
+	"gw-currency-wallet/internal/auth"
 	"gw-currency-wallet/internal/config"
-	"log"
+	"gw-currency-wallet/internal/grpc/exchanger"
+	"gw-currency-wallet/internal/health"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/mailer"
+	"gw-currency-wallet/internal/metrics"
+	"gw-currency-wallet/internal/tracing"
 	"net/http"
-	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -28,51 +34,79 @@ import (
 // @name Authorization
 func main() {
 	// Инициализация логгера
-	logger, err := zap.NewProduction()
-	if err != nil {
-		log.Fatalf("Failed to initialize logger: %v", err)
-	}
+	logger := logging.New()
 	defer logger.Sync()
 
-	// Контекст для graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Загрузка конфигурации
-	cfg, err := config.LoadConfig("config.env")
+	// Загрузка конфигурации: окружение, необязательный файл и значения по умолчанию
+	configFile := config.File()
+	cfg, err := config.LoadConfig(configFile)
 	if err != nil {
 		logger.Fatal("Failed to load config", zap.Error(err))
 	}
-	logger.Info("Конфигурация загружена", zap.Any("cfg", cfg))
+	logger.Info("Конфигурация загружена", zap.String("file", configFile), zap.Any("cfg", cfg.Redacted()))
 
-	// Формирование URL для подключения к базе данных
-	dbURL, err := cfg.Postgres.ConnectionURL()
+	// Трассировка OpenTelemetry: экспорт спанов и передача traceparent
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		logger.Fatal("Failed to generate DB connection URL", zap.Error(err))
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
 	}
 
+	// Метрики Prometheus, отдаются на /metrics
+	mt := metrics.New()
+
 	// Инициализация gRPC-клиента
-	conn, err := grpc.NewClient(cfg.GRPC.Addr, grpc.WithInsecure())
+	conn, err := grpc.NewClient(cfg.GRPC.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(mt.UnaryClientInterceptor()), grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
 	if err != nil {
 		logger.Fatal("Failed to connect to gRPC server", zap.Error(err))
 	}
 	defer conn.Close()
 
-	exchangeClient := pb.NewExchangeServiceClient(conn)
+	exchangeClient := exchanger.NewExchangerClient(conn, cfg.GRPC, logger)
+
+	// Проверки готовности для /readyz, проверки БД добавляются при её подключении
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.Add("exchanger", func(context.Context) error { return exchangeClient.Ready() })
+
+	// Инициализация хешера паролей
+	hasher, err := auth.NewPasswordHasher(cfg.Password)
+	if err != nil {
+		logger.Fatal("Failed to initialize password hasher", zap.Error(err))
+	}
+
+	// Ключи подписи access-токенов
+	tokens, err := auth.NewKeySet(cfg.JWT)
+	if err != nil {
+		logger.Fatal("Failed to initialize JWT keys", zap.Error(err))
+	}
+
+	// Отправка писем: подтверждение email и сброс пароля
+	mail, err := mailer.New(cfg.Mail, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize mailer", zap.Error(err))
+	}
 
 	// Инициализация кэша
-	c := cache.New(5*time.Minute, 10*time.Minute) // TTL 5 минут, интервал очистки 10 минут
+	c := cache.New(cfg.Cache.TTL, cfg.Cache.CleanupInterval)
+
+	// Контекст фоновых задач (пересчёт метрик и т.п.) отменяется по сигналу остановки
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	// Настройка роутинга
-	router, err := app.NewRoutes(logger, dbURL, cfg.Postgres.MigrationsPath, exchangeClient, c)
+	router, closeStorage, err := app.NewRoutes(ctx, logger, cfg, exchangeClient, c, hasher, tokens, mail, mt, checker)
 	if err != nil {
 		logger.Fatal("Failed to create routes", zap.Error(err))
 	}
 
 	// Запуск сервера
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: router,
+		Addr:              cfg.HTTP.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
 	}
 
 	// Graceful shutdown
@@ -83,16 +117,31 @@ func main() {
 	}()
 
 	// Ожидание сигналов для graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	<-ctx.Done()
+	// Повторный сигнал завершит процесс сразу, не дожидаясь остановки
+	stop()
 
 	logger.Info("Shutting down server...")
 
-	// Остановка сервера с таймаутом
-	if err := srv.Shutdown(ctx); err != nil {
+	// Сначала /readyz начинает отвечать 503, и балансировщик перестаёт слать новые запросы.
+	// Сервер продолжает обслуживать всех, пока не пройдёт ShutdownDelay
+	checker.Shutdown()
+	time.Sleep(cfg.Health.ShutdownDelay)
+
+	// Остановка сервера с таймаутом: текущие запросы дорабатывают, новые соединения не принимаются
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Текущие запросы (в том числе проверки /readyz) завершены, фоновые задачи остановлены отменой ctx - можно закрыть пул
+	closeStorage()
+
+	// Отправка спанов, накопленных до остановки
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
+
 	logger.Info("Server exited")
 }
@@ -2,45 +2,228 @@ package app
 
 import (
 	"context"
-	pb "github.com/galkin09/proto-exchange/exchange"
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
 	"go.uber.org/zap"
 	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/config"
+	"gw-currency-wallet/internal/grpc/exchanger"
 	"gw-currency-wallet/internal/handlers"
+	"gw-currency-wallet/internal/health"
+	"gw-currency-wallet/internal/idempotency"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/mailer"
+	"gw-currency-wallet/internal/metrics"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/ratelimit"
+	"gw-currency-wallet/internal/requestid"
+	"gw-currency-wallet/internal/storages/postgres"
+	"gw-currency-wallet/internal/tracing"
+	"gw-currency-wallet/internal/validation"
+	"sync"
+	"time"
 
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
 	_ "gw-currency-wallet/docs"
 )
 
-func NewRoutes(logger *zap.Logger, dbURL string, migrationsPath string, exchangeClient pb.ExchangeServiceClient, cache *cache.Cache) (*gin.Engine, error) {
-	ctx := context.Background()
+// NewRoutes подключает хранилище и собирает маршруты. Фоновые задачи работают, пока не отменён ctx.
+// Возвращаемая функция закрывает пул соединений: её вызывают после остановки HTTP-сервера и отмены ctx
+func NewRoutes(ctx context.Context, logger *zap.Logger, cfg *config.Config, exchangeClient *exchanger.ExchangerClient, cache *cache.Cache, hasher *auth.PasswordHasher,
+	tokens *auth.KeySet, m mailer.Mailer, mt *metrics.Metrics,
+	checker *health.Checker) (*gin.Engine, func(), error) {
+	psql := postgres.NewPSQL(logger)
+	if err := psql.Start(ctx, cfg.Postgres); err != nil {
+		logger.Error("Failed to initialize PostgreSQL", zap.Error(err))
+		return nil, nil, err
+	}
+
+	checker.Add("postgres", psql.Ping)
+	checker.Add("migrations", psql.CheckMigrations)
+
+	// Статистика пула соединений читается при каждом сборе метрик, суммы балансов пересчитываются по таймеру
+	if err := mt.Register(metrics.NewPoolCollector(psql.PoolStat)); err != nil {
+		logger.Error("Failed to register pool metrics", zap.Error(err))
+		psql.Stop()
+		return nil, nil, err
+	}
 
-	h, err := handlers.NewHandler(ctx, logger, dbURL, migrationsPath, exchangeClient, cache)
-	if err != nil {
-		logger.Error(err.Error())
-		return nil, err
+	// Правила проверки тел запросов; валюты и их точность берутся из справочника, он перечитывается раз в минуту
+	if err := validation.Register(validation.NewCurrencies(psql, time.Minute)); err != nil {
+		logger.Error("Failed to register validation rules", zap.Error(err))
+		psql.Stop()
+		return nil, nil, err
 	}
 
-	r := gin.Default()
+	// Счётчики лимитов и неудачных входов: в памяти экземпляра или общие в PostgreSQL
+	var limits ratelimit.Backend
+	if cfg.RateLimit.Store == "postgres" {
+		limits = psql
+	} else {
+		limits = ratelimit.NewMemory(max(cfg.RateLimit.Login.LockoutDuration, cfg.MFA.StepUpLockout))
+	}
+
+	h := handlers.NewHandler(logger, cfg, psql, exchangeClient, cache, hasher, tokens, m,
+		ratelimit.NewLoginGuard(limits, ratelimit.ScopeLogin, cfg.RateLimit.Login),
+		ratelimit.NewLoginGuard(limits, ratelimit.ScopeStepUp, cfg.MFA.StepUpGuard()), mt)
+
+	// Повтор запроса с тем же Idempotency-Key не проводит операцию повторно
+	idem := idempotency.Middleware(psql, cfg.Idempotency.TTL, logger)
+	// Крупные снятия и переводы требуют свежего кода TOTP
+	stepUp := h.RequireFreshTOTP()
+	// Пока email не подтверждён, операции с деньгами недоступны
+	verified := auth.RequireVerified()
 
+	// Лимиты запросов: публичные и входные ручки считаются по IP, остальные - по пользователю.
+	// Лимит на деньги стоит раньше step-up и идемпотентности: отказ 429 не сохраняется как ответ, а подбор TOTP ограничен
+	publicLimit := ratelimit.Middleware(limits, "public", cfg.RateLimit.Public, ratelimit.ByIP, logger)
+	authLimit := ratelimit.Middleware(limits, "auth", cfg.RateLimit.Auth, ratelimit.ByIP, logger)
+	userLimit := ratelimit.Middleware(limits, "user", cfg.RateLimit.User, ratelimit.ByUser, logger)
+	moneyLimit := ratelimit.Middleware(limits, "money", cfg.RateLimit.Money, ratelimit.ByUser, logger)
+
+	// Вместо текстового журнала gin.Default() - JSON-журнал запросов с маскированием
+	r := gin.New()
+	// IP клиента берётся из X-Forwarded-For только от доверенных прокси, иначе лимит по IP легко обойти
+	if err := r.SetTrustedProxies(cfg.RateLimit.TrustedProxies); err != nil {
+		logger.Error("Invalid trusted proxies", zap.Error(err))
+		psql.Stop()
+		return nil, nil, err
+	}
+	// Значения контекста запроса (например, request ID) доступны через *gin.Context в хранилище
+	r.ContextWithFallback = true
+	r.Use(
+		requestid.Middleware(),
+		tracing.Middleware(),
+		logging.Middleware(logger, "/healthz", "/readyz", "/metrics"),
+		mt.HTTP(),
+		logging.Recovery(logger),
+	)
+	r.NoRoute(problem.NoRoute)
+
+	r.GET("/metrics", mt.Handler())
+	r.GET("/healthz", checker.Liveness)
+	r.GET("/readyz", checker.Readiness)
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	r.GET("/health/exchanger", h.ExchangerHealth)
+	r.GET("/.well-known/jwks.json", h.JWKS)
 
-	public := r.Group("/api/v1")
+	public := r.Group("/api/v1").Use(publicLimit)
 	{
-		public.POST("/register", h.RegisterUser)
-		public.POST("/login", h.LoginUser)
+		public.POST("/register", authLimit, h.RegisterUser)
+		public.POST("/login", authLimit, h.LoginUser)
+		public.POST("/login/mfa", authLimit, h.LoginMFA)
+		public.POST("/token/refresh", authLimit, h.RefreshToken)
+		public.GET("/email/verify", h.VerifyEmail)
+		public.POST("/password/forgot", authLimit, h.ForgotPassword)
+		public.POST("/password/reset", authLimit, h.ResetPassword)
+		public.GET("/currencies", h.ListCurrencies)
 	}
 
-	protected := r.Group("/api/v1").Use(auth.Auth())
+	protected := r.Group("/api/v1").Use(auth.Auth(tokens, psql), userLimit)
 	{
+		protected.POST("/logout", h.Logout)
+		protected.GET("/sessions", h.ListSessions)
+		protected.POST("/email/verify/resend", h.ResendVerification)
+		protected.POST("/mfa/totp/enroll", h.EnrollTOTP)
+		protected.POST("/mfa/totp/confirm", h.ConfirmTOTP)
+		protected.DELETE("/sessions/:id", h.RevokeSession)
 		protected.GET("/balance", h.GetBalance)
-		protected.POST("/wallet/deposit", h.Deposit)
-		protected.POST("/wallet/withdraw", h.Withdraw)
+		protected.POST("/wallet/deposit", verified, moneyLimit, idem, h.Deposit)
+		protected.POST("/wallet/withdraw", verified, moneyLimit, stepUp, idem, h.Withdraw)
 		protected.GET("/exchange/rates", h.ExchangeRates)
-		protected.POST("/exchange", h.Exchange)
+		protected.POST("/exchange/quotes", verified, moneyLimit, h.CreateQuote)
+		protected.POST("/exchange", verified, moneyLimit, idem, h.Exchange)
+		protected.GET("/transactions", h.GetTransactions)
+		protected.POST("/transfers", verified, moneyLimit, stepUp, idem, h.Transfer)
 	}
 
-	return r, nil
+	// Административное API: права проверяются по роли из access-токена, действия пишутся в журнал аудита
+	admin := r.Group("/api/v1/admin").Use(auth.Auth(tokens, psql), userLimit)
+	{
+		admin.GET("/users", auth.Require(auth.PermUsersRead), h.AdminSearchUsers)
+		admin.PUT("/users/:id/role", auth.Require(auth.PermUsersManage), h.AdminSetUserRole)
+		admin.GET("/wallets/:uuid", auth.Require(auth.PermWalletsRead), h.AdminGetWallet)
+		admin.GET("/wallets/:uuid/transactions", auth.Require(auth.PermWalletsRead), h.AdminWalletTransactions)
+		admin.POST("/wallets/:uuid/freeze", auth.Require(auth.PermWalletsFreeze), h.AdminFreezeWallet)
+		admin.POST("/wallets/:uuid/unfreeze", auth.Require(auth.PermWalletsFreeze), h.AdminUnfreezeWallet)
+		admin.POST("/wallets/:uuid/adjustments", auth.Require(auth.PermWalletsAdjust), idem, h.AdminAdjustWallet)
+		admin.GET("/audit", auth.Require(auth.PermAuditRead), h.AdminAuditLog)
+	}
+
+	// Фоновые задачи запускаются последними, чтобы при ошибке выше их не пришлось останавливать
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		mt.RunBusiness(ctx, psql, cfg.Metrics.BusinessInterval, logger)
+	}()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		h.RunMailQueue()
+	}()
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		purgeIdempotencyKeys(ctx, psql, logger)
+	}()
+	if cfg.RateLimit.Store == "postgres" {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			purgeRateLimits(ctx, psql, cfg.RateLimit, max(cfg.RateLimit.Login.LockoutDuration, cfg.MFA.StepUpLockout), logger)
+		}()
+	}
+
+	// Пул закрывается только после того, как фоновые задачи увидели отмену ctx и завершились,
+	// а очередь писем дослана: closeStorage вызывается после остановки сервера, новых писем уже не будет
+	closeStorage := func() {
+		h.CloseMailQueue()
+		background.Wait()
+		psql.Stop()
+	}
+
+	return r, closeStorage, nil
+}
+
+// purgeRateLimits раз в час удаляет из PostgreSQL корзины лимитов и попытки входа, которые давно не использовались,
+// пока не отменён ctx. loginWindow - сколько помнить неудачные попытки входа и step-up
+func purgeRateLimits(ctx context.Context, psql *postgres.PSQL, cfg config.RateLimitConfig, loginWindow time.Duration, logger *zap.Logger) {
+	// Корзина, не тронутая дольше самого длинного периода, уже полна - её можно удалить без потери состояния
+	olderThan := time.Hour
+	for _, l := range []config.RateLimit{cfg.Public, cfg.Auth, cfg.User, cfg.Money} {
+		olderThan = max(olderThan, l.Period)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := psql.PurgeRateLimits(ctx, olderThan, loginWindow); err != nil && ctx.Err() == nil {
+			logger.Warn("Could not purge rate limits", zap.Error(err))
+		}
+	}
+}
+
+// purgeIdempotencyKeys раз в час удаляет истёкшие ключи идемпотентности, пока не отменён ctx
+func purgeIdempotencyKeys(ctx context.Context, psql *postgres.PSQL, logger *zap.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := psql.PurgeIdempotencyKeys(ctx); err != nil && ctx.Err() == nil {
+			logger.Warn("Could not purge idempotency keys", zap.Error(err))
+		}
+	}
 }
@@ -1,34 +1,70 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"gw-currency-wallet/internal/storages"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var (
-	jwtSecret  = []byte("SecretSalt")
-	ExpireTime time.Duration
-)
+var ErrUnknownKey = errors.New("unknown signing key")
 
+// Claims содержимое access-токена. Subject (sub) - id пользователя, он не меняется при смене имени.
+// ID (jti) позволяет отозвать токен до истечения срока, SessionID - сессия, в которой он выдан.
+// Role определяет права токена, при смене роли сессии пользователя отзываются.
+// EmailVerified - подтверждён ли email на момент выдачи, обновляется со следующим refresh
 type Claims struct {
 	jwt.RegisteredClaims
-	Username string `json:"username"`
+	WalletUUID    string `json:"wallet"`
+	Role          string `json:"role"`
+	SessionID     string `json:"sid"`
+	EmailVerified bool   `json:"ev"`
+}
+
+// Principal пользователь, от имени которого выдан токен
+func (c *Claims) Principal() (Principal, error) {
+	userID, err := strconv.Atoi(c.Subject)
+	if err != nil || userID < 1 {
+		return Principal{}, fmt.Errorf("invalid subject %q", c.Subject)
+	}
+	if !KnownRole(c.Role) {
+		return Principal{}, fmt.Errorf("unknown role %q", c.Role)
+	}
+	return Principal{
+		UserID:        userID,
+		WalletUUID:    c.WalletUUID,
+		Role:          c.Role,
+		SessionID:     c.SessionID,
+		TokenID:       c.ID,
+		EmailVerified: c.EmailVerified,
+	}, nil
 }
 
-func GenerateToken(user storages.User, expireTime time.Duration) (string, error) {
+// GenerateToken выпускает access-токен сессии sessionID с идентификатором tokenID.
+// Токен подписывается текущим ключом, его kid записывается в заголовок
+func (ks *KeySet) GenerateToken(user storages.User, sessionID, tokenID string, expiresAt time.Time) (string, error) {
 	claims := Claims{
-		Username: user.Username,
+		WalletUUID:    user.WalletUUID,
+		Role:          user.Role,
+		SessionID:     sessionID,
+		EmailVerified: user.EmailVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expireTime)),
+			Subject:   strconv.Itoa(user.ID),
+			ID:        tokenID,
+			Issuer:    ks.issuer,
+			Audience:  jwt.ClaimStrings{ks.audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+
+	tokenString, err := token.SignedString(ks.signing.private)
 	if err != nil {
 		return "", err
 	}
@@ -36,15 +72,30 @@ func GenerateToken(user storages.User, expireTime time.Duration) (string, error)
 	return tokenString, nil
 }
 
-func ParseToken(tokenString string) (*Claims, error) {
+// ParseToken проверяет подпись ключом из заголовка kid. Алгоритм токена обязан совпадать
+// с алгоритмом этого ключа, iss и aud - с настройками сервиса
+func (ks *KeySet) ParseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods(ks.methods),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithAudience(ks.audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("token is malformed: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.ID != "" && claims.SessionID != "" && claims.WalletUUID != "" {
 		return claims, nil
 	}
 
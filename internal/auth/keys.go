@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"gw-currency-wallet/internal/config"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	minHMACSecretLen = 32
+	minRSABits       = 2048
+)
+
+// KeySet ключи подписи access-токенов. Новые токены подписываются одним ключом,
+// проверяются любым из действующих: так ключ можно сменить, не обрывая выданные сессии
+type KeySet struct {
+	signing  *signingKey
+	keys     map[string]*signingKey
+	methods  []string
+	issuer   string
+	audience string
+}
+
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	// private - ключ подписи, nil для ключей только для проверки
+	private any
+	public  any
+}
+
+func NewKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, fmt.Errorf("jwt issuer and audience are required")
+	}
+
+	ks := &KeySet{
+		keys:     make(map[string]*signingKey, len(cfg.Keys)),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+	}
+
+	seen := make(map[string]bool)
+	for _, kc := range cfg.Keys {
+		if _, ok := ks.keys[kc.ID]; ok {
+			return nil, fmt.Errorf("duplicate jwt key id %q", kc.ID)
+		}
+
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		ks.keys[kc.ID] = key
+
+		if !seen[kc.Algorithm] {
+			seen[kc.Algorithm] = true
+			ks.methods = append(ks.methods, kc.Algorithm)
+		}
+	}
+
+	signing, ok := ks.keys[cfg.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt signing key %q is not configured", cfg.SigningKeyID)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("jwt signing key %q has no private key", cfg.SigningKeyID)
+	}
+	ks.signing = signing
+
+	return ks, nil
+}
+
+func loadKey(kc config.JWTKeyConfig) (*signingKey, error) {
+	key := &signingKey{id: kc.ID}
+
+	switch kc.Algorithm {
+	case AlgHS256:
+		if len(kc.Secret) < minHMACSecretLen {
+			return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minHMACSecretLen)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.private = []byte(kc.Secret)
+		key.public = key.private
+		return key, nil
+	case AlgRS256:
+		key.method = jwt.SigningMethodRS256
+	case AlgEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+
+	if kc.PEMFile == "" {
+		return nil, fmt.Errorf("%s key requires a PEM file", kc.Algorithm)
+	}
+	data, err := os.ReadFile(kc.PEMFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", kc.PEMFile)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := key.private.(type) {
+	case *rsa.PrivateKey:
+		key.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		key.public = private.Public()
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		if kc.Algorithm != AlgRS256 {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", kc.Algorithm)
+		}
+		if public.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+	case ed25519.PublicKey:
+		if kc.Algorithm != AlgEdDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", kc.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.public)
+	}
+
+	return key, nil
+}
+
+// JWK открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS набор открытых ключей для /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS открытые ключи для проверки токенов другими сервисами. Симметричные ключи HS256 не публикуются
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -1,32 +1,57 @@
 package auth
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
-	"net/http"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/problem"
 	"strings"
 )
 
-func Auth() gin.HandlerFunc {
+// RevocationList список отозванных access-токенов
+type RevocationList interface {
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+func Auth(keys *KeySet, revoked RevocationList) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
+			problem.Respond(c, problem.CodeUnauthorized, "authorization header is required")
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token format"})
+			problem.Respond(c, problem.CodeUnauthorized, "invalid token format")
+			return
+		}
+
+		claims, err := keys.ParseToken(tokenString)
+		if err != nil {
+			problem.Respond(c, problem.CodeUnauthorized, "invalid token")
 			return
 		}
 
-		claims, err := ParseToken(tokenString)
+		principal, err := claims.Principal()
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			problem.Respond(c, problem.CodeUnauthorized, "invalid token")
+			return
+		}
+
+		isRevoked, err := revoked.IsAccessTokenRevoked(c, claims.ID)
+		if err != nil {
+			problem.Respond(c, problem.CodeUnavailable, "could not verify token")
+			return
+		}
+		if isRevoked {
+			problem.Respond(c, problem.CodeUnauthorized, "token has been revoked")
 			return
 		}
 
-		c.Set("username", claims.Username)
+		setPrincipal(c, principal)
+		logging.With(c, zap.Int("user_id", principal.UserID))
 		c.Next()
 	}
 }
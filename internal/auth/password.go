@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gw-currency-wallet/internal/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgoBcrypt   = "bcrypt"
+	AlgoArgon2id = "argon2id"
+
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// PasswordHasher хеширует и проверяет пароли выбранным в конфигурации алгоритмом.
+// Проверка понимает хеши любого поддерживаемого алгоритма, поэтому смена алгоритма
+// или стоимости не ломает вход: устаревшие хеши помечаются для перехеширования.
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Params
+	dummyHash  string
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func NewPasswordHasher(cfg config.PasswordConfig) (*PasswordHasher, error) {
+	h := &PasswordHasher{
+		algorithm:  cfg.Algorithm,
+		bcryptCost: cfg.BcryptCost,
+		argon2: argon2Params{
+			time:    uint32(cfg.Argon2Time),
+			memory:  uint32(cfg.Argon2Memory),
+			threads: uint8(cfg.Argon2Threads),
+		},
+	}
+
+	switch h.algorithm {
+	case AlgoBcrypt:
+		if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgoArgon2id:
+		if cfg.Argon2Time < 1 || cfg.Argon2Memory < 8*cfg.Argon2Threads || cfg.Argon2Threads < 1 || cfg.Argon2Threads > 255 {
+			return nil, fmt.Errorf("invalid argon2id parameters")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %q", h.algorithm)
+	}
+
+	// Хеш случайного пароля для выравнивания времени ответа при входе несуществующего пользователя
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	dummy, err := h.Hash(base64.RawStdEncoding.EncodeToString(buf))
+	if err != nil {
+		return nil, err
+	}
+	h.dummyHash = dummy
+
+	return h, nil
+}
+
+// Hash возвращает хеш пароля с солью в закодированном виде
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgoArgon2id {
+		return h.hashArgon2(password)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify сравнивает пароль с сохранённым хешем за постоянное время.
+// needsRehash == true, если хеш построен другим алгоритмом или с другими параметрами.
+// Значения без префикса алгоритма считаются паролями, сохранёнными до введения хеширования.
+func (h *PasswordHasher) Verify(password, encoded string) (match bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.verifyArgon2(password, encoded)
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.algorithm != AlgoBcrypt || cost != h.bcryptCost, nil
+	default:
+		match := subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1
+		return match, match, nil
+	}
+}
+
+// VerifyDummy тратит на проверку столько же времени, сколько Verify для существующего пользователя
+func (h *PasswordHasher) VerifyDummy(password string) {
+	_, _, _ = h.Verify(password, h.dummyHash)
+}
+
+// hashArgon2 кодирует хеш в формате PHC: $argon2id$v=19$m=...,t=...,p=...$salt$hash
+func (h *PasswordHasher) hashArgon2(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.argon2.time, h.argon2.memory, h.argon2.threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.argon2.memory, h.argon2.time, h.argon2.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *PasswordHasher) verifyArgon2(password, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrMalformedHash
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return false, false, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrMalformedHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, h.algorithm != AlgoArgon2id || p != h.argon2, nil
+}
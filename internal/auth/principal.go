@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"gw-currency-wallet/internal/problem"
+)
+
+const principalKey = "auth.principal"
+
+// Principal аутентифицированный пользователь запроса, берётся из проверенного access-токена
+type Principal struct {
+	UserID        int
+	WalletUUID    string
+	Role          string
+	SessionID     string
+	TokenID       string
+	EmailVerified bool
+}
+
+func setPrincipal(c *gin.Context, p Principal) {
+	c.Set(principalKey, p)
+}
+
+// PrincipalFrom пользователь запроса. ok == false, если запрос прошёл мимо Auth()
+func PrincipalFrom(c *gin.Context) (Principal, bool) {
+	v, exists := c.Get(principalKey)
+	if !exists {
+		return Principal{}, false
+	}
+	p, ok := v.(Principal)
+	return p, ok
+}
+
+// RequireVerified пропускает запрос, только если email пользователя подтверждён.
+// Без подтверждения доступны только операции чтения. Должен стоять после Auth()
+func RequireVerified() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			problem.Respond(c, problem.CodeUnauthorized, "user not authenticated")
+			return
+		}
+		if !principal.EmailVerified {
+			problem.Respond(c, problem.CodeEmailNotVerified, "email address is not verified")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+)
+
+// Permission право на группу маршрутов административного API
+type Permission string
+
+const (
+	PermUsersRead     Permission = "users:read"
+	PermUsersManage   Permission = "users:manage"
+	PermWalletsRead   Permission = "wallets:read"
+	PermWalletsFreeze Permission = "wallets:freeze"
+	PermWalletsAdjust Permission = "wallets:adjust"
+	PermAuditRead     Permission = "audit:read"
+)
+
+// rolePermissions права ролей. Обычный пользователь работает только со своим кошельком и прав не имеет
+var rolePermissions = map[string]map[Permission]bool{
+	storages.RoleUser: {},
+	storages.RoleSupport: {
+		PermUsersRead:     true,
+		PermWalletsRead:   true,
+		PermWalletsFreeze: true,
+	},
+	storages.RoleAdmin: {
+		PermUsersRead:     true,
+		PermUsersManage:   true,
+		PermWalletsRead:   true,
+		PermWalletsFreeze: true,
+		PermWalletsAdjust: true,
+		PermAuditRead:     true,
+	},
+}
+
+// KnownRole сообщает, существует ли роль
+func KnownRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can сообщает, есть ли у пользователя право perm
+func (p Principal) Can(perm Permission) bool {
+	return rolePermissions[p.Role][perm]
+}
+
+// Require пропускает запрос, только если у пользователя есть право perm. Должен стоять после Auth()
+func Require(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			problem.Respond(c, problem.CodeUnauthorized, "user not authenticated")
+			return
+		}
+		if !principal.Can(perm) {
+			problem.Respond(c, problem.CodeForbidden, "insufficient permissions")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const refreshTokenBytes = 32
+
+// NewRefreshToken случайный непрозрачный refresh-токен и его хеш для хранения в БД
+func NewRefreshToken() (token, hash string, err error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken SHA-256 токена. Токен случайный и длинный, поэтому соль и медленный хеш не нужны
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewUserToken токен для ссылки из письма (подтверждение email, сброс пароля) и его хеш.
+// Устроен как refresh-токен: случайный, одноразовый, в БД хранится только хеш
+func NewUserToken() (token, hash string, err error) {
+	return NewRefreshToken()
+}
+
+// HashUserToken хеш токена из письма для поиска в БД
+func HashUserToken(token string) string {
+	return HashRefreshToken(token)
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret ключ "12345678901234567890" из тестовых векторов RFC 6238 (SHA1) в base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Коды RFC 6238 восьмизначные, у шестизначных берутся последние 6 цифр
+func TestValidateTOTPVectors(t *testing.T) {
+	tests := []struct {
+		unix     int64
+		code     string
+		wantStep int64
+	}{
+		{59, "287082", 1},
+		{1111111109, "081804", 37037036},
+		{1234567890, "005924", 41152263},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, 0, time.Unix(tt.unix, 0))
+		if !ok || step != tt.wantStep {
+			t.Errorf("ValidateTOTP(%q, T=%d) = %d, %v; want %d, true", tt.code, tt.unix, step, ok, tt.wantStep)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	const (
+		code = "081804"
+		step = 37037036
+	)
+	at := func(s int64) time.Time { return time.Unix(s*30+15, 0) }
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"current step", at(step), true},
+		{"client one step behind", at(step + 1), true},
+		{"client one step ahead", at(step - 1), true},
+		{"two steps behind", at(step + 2), false},
+		{"two steps ahead", at(step - 2), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(rfc6238Secret, code, 0, tt.now)
+			if ok != tt.want {
+				t.Fatalf("ok = %v, want %v", ok, tt.want)
+			}
+			if ok && got != step {
+				t.Errorf("step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	const step = 37037036
+
+	if _, ok := ValidateTOTP(rfc6238Secret, "081804", step, now); ok {
+		t.Error("code for an already used step was accepted")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, "081804", step+1, now); ok {
+		t.Error("code for a step older than the last used one was accepted")
+	}
+	if got, ok := ValidateTOTP(rfc6238Secret, "081804", step-1, now); !ok || got != step {
+		t.Errorf("code for a new step = %d, %v; want %d, true", got, ok, step)
+	}
+}
+
+func TestValidateTOTPMalformed(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"lowercase secret", strings.ToLower(rfc6238Secret), "081804", true},
+		{"eight digits", rfc6238Secret, "07081804", false},
+		{"five digits", rfc6238Secret, "81804", false},
+		{"empty code", rfc6238Secret, "", false},
+		{"wrong code", rfc6238Secret, "081805", false},
+		{"invalid secret", "not base32!", "081804", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, 0, now); ok != tt.want {
+				t.Errorf("ok = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
@@ -1,26 +1,72 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// DefaultFile файл конфигурации по умолчанию, другой путь задаётся переменной CONFIG_FILE
+const DefaultFile = "config.env"
+
+// redactedValue подставляется вместо секретов при выводе конфигурации
+const redactedValue = "***"
+
+// Config конфигурация сервиса. Значения берутся из переменных окружения, необязательный файл
+// конфигурации лишь дополняет окружение: переменная, заданная в окружении, важнее строки из файла
 type Config struct {
-	Postgres PostgresConfig
-	GRPC     GRPCConfig
+	HTTP        HTTPConfig
+	Postgres    PostgresConfig
+	GRPC        GRPCConfig
+	Password    PasswordConfig
+	Idempotency IdempotencyConfig
+	Rates       RatesConfig
+	Session     SessionConfig
+	JWT         JWTConfig
+	MFA         MFAConfig
+	Mail        MailConfig
+	Account     AccountConfig
+	RateLimit   RateLimitConfig
+	Metrics     MetricsConfig
+	Tracing     TracingConfig
+	Health      HealthConfig
+	Cache       CacheConfig
+}
+
+// HTTPConfig содержит настройки HTTP-сервера.
+// Таймауты защищают от медленных клиентов, ShutdownTimeout - сколько ждать завершения текущих запросов при остановке
+type HTTPConfig struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
 }
 
 // PostgresConfig содержит настройки для подключения к PostgreSQL.
+// ConnTimeout - таймаут установки соединения и первоначального подключения при старте,
+// MaxConns/MinConns - размер пула, MaxConnLifetime/MaxConnIdleTime - когда соединение пула пересоздаётся
 type PostgresConfig struct {
-	User           string
-	Password       string
-	Host           string
-	Port           string
-	Database       string
-	ConnTimeout    int
-	MigrationsPath string
+	User            string
+	Password        string `json:"-"`
+	Host            string
+	Port            string
+	Database        string
+	ConnTimeout     time.Duration
+	MaxConns        int
+	MinConns        int
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	MigrationsPath  string
 }
 
 // ConnectionURL генерирует строку подключения к PostgreSQL
@@ -28,43 +74,776 @@ func (c *PostgresConfig) ConnectionURL() (string, error) {
 	if c.Host == "" || c.Port == "" || c.Database == "" || c.User == "" || c.Password == "" {
 		return "", fmt.Errorf("некоторые параметры подключения отсутствуют")
 	}
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", c.User, c.Password, c.Host, c.Port, c.Database), nil
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   net.JoinHostPort(c.Host, c.Port),
+		Path:   "/" + c.Database,
+	}
+	q := url.Values{"sslmode": {"disable"}}
+	if c.ConnTimeout > 0 {
+		// connect_timeout задаётся в целых секундах
+		q.Set("connect_timeout", strconv.Itoa(int(max(c.ConnTimeout.Round(time.Second), time.Second)/time.Second)))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
 }
 
-// GRPCConfig содержит настройки для подключения к gRPC
+// GRPCConfig содержит настройки для подключения к gRPC.
+// CallTimeout - дедлайн одной попытки вызова, MaxRetries - число повторов при временных ошибках,
+// RetryBackoff/RetryBackoffMax - начальная и максимальная задержка между повторами,
+// BreakerThreshold - число неудачных вызовов подряд до размыкания выключателя,
+// BreakerCooldown - время, через которое разомкнутый выключатель пропустит пробный вызов
 type GRPCConfig struct {
-	Addr string
+	Addr             string
+	CallTimeout      time.Duration
+	MaxRetries       int
+	RetryBackoff     time.Duration
+	RetryBackoffMax  time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// PasswordConfig содержит настройки хеширования паролей.
+// Algorithm - "bcrypt" или "argon2id", остальные поля - параметры стоимости.
+type PasswordConfig struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    int
+	Argon2Memory  int // в KiB
+	Argon2Threads int
+}
+
+// IdempotencyConfig содержит настройки обработки заголовка Idempotency-Key.
+// TTL - сколько хранится ключ и сохранённый ответ
+type IdempotencyConfig struct {
+	TTL time.Duration
+}
+
+// RatesConfig содержит настройки работы с курсами валют.
+// MaxAge - максимальный возраст сохранённого курса, по которому допускается обмен при недоступности обменника,
+// QuoteTTL - сколько действует выданная котировка обмена
+type RatesConfig struct {
+	MaxAge   time.Duration
+	QuoteTTL time.Duration
+}
+
+// SessionConfig содержит настройки сессий.
+// AccessTTL - срок действия access-токена, дальше его нужно обновить по refresh-токену,
+// RefreshTTL - срок действия refresh-токена, каждое обновление продлевает сессию на этот срок
+type SessionConfig struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// JWTConfig содержит настройки подписи access-токенов.
+// Issuer и Audience записываются в токен и проверяются при разборе,
+// SigningKeyID - kid ключа, которым подписываются новые токены,
+// Keys - все действующие ключи: при ротации старый ключ остаётся для проверки выданных им токенов
+type JWTConfig struct {
+	Issuer       string
+	Audience     string
+	SigningKeyID string
+	Keys         []JWTKeyConfig
+}
+
+// JWTKeyConfig ключ подписи. Для HS256 задаётся Secret, для RS256 и EdDSA - PEMFile
+// с закрытым ключом (или только открытым, если ключ используется лишь для проверки)
+type JWTKeyConfig struct {
+	ID        string
+	Algorithm string
+	Secret    string `json:"-"`
+	PEMFile   string
+}
+
+// MFAConfig содержит настройки двухфакторной аутентификации.
+// Issuer - название сервиса в приложении-аутентификаторе, ChallengeTTL - сколько действует токен второго шага входа,
+// StepUpThresholds - суммы по валютам, начиная с которых снятие и перевод требуют свежего кода TOTP;
+// в валютах без порога код требуется при любой сумме. После StepUpMaxFailures неверных кодов подряд
+// step-up блокируется на StepUpLockout, чтобы код нельзя было подобрать с украденным access-токеном
+type MFAConfig struct {
+	Issuer            string
+	ChallengeTTL      time.Duration
+	StepUpThresholds  map[string]decimal.Decimal
+	StepUpMaxFailures int
+	StepUpLockout     time.Duration
+}
+
+// StepUpGuard настройки ratelimit.LoginGuard для step-up: без задержек до StepUpMaxFailures неудач, дальше блокировка
+func (c MFAConfig) StepUpGuard() LoginGuardConfig {
+	return LoginGuardConfig{
+		FreeAttempts:     c.StepUpMaxFailures - 1,
+		BaseDelay:        c.StepUpLockout,
+		MaxDelay:         c.StepUpLockout,
+		LockoutThreshold: c.StepUpMaxFailures,
+		LockoutDuration:  c.StepUpLockout,
+	}
+}
+
+// MailConfig содержит настройки отправки писем.
+// Driver - "smtp", "file" (письма складываются в Dir) или "log" (письма пишутся в лог),
+// From - адрес отправителя, SendTimeout - сколько ждать отправки одного письма
+type MailConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string `json:"-"`
+	Dir          string
+	SendTimeout  time.Duration
+}
+
+// AccountConfig содержит настройки подтверждения email и сброса пароля.
+// VerifyURL и ResetURL - адреса ссылок из писем, токен добавляется к ним параметром token,
+// VerificationTTL и ResetTTL - сроки действия ссылок
+type AccountConfig struct {
+	VerifyURL       string
+	ResetURL        string
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration
+}
+
+// RateLimit лимит группы маршрутов: Requests запросов за Period. Корзина вмещает Requests токенов
+// и пополняется равномерно, поэтому лимит допускает всплеск до Requests запросов. Нулевой лимит отключён
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled сообщает, включён ли лимит
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
 }
 
-// LoadConfig загружает конфигурацию из файла .env.
+// RateLimitConfig содержит настройки ограничения частоты запросов.
+// Store - "memory" (у каждого экземпляра свои счётчики) или "postgres" (общие счётчики),
+// TrustedProxies - адреса прокси, которым можно доверить X-Forwarded-For при определении IP клиента.
+// Public и Auth ограничивают запросы с одного IP к открытым маршрутам и ко входу,
+// User и Money - запросы одного пользователя ко всему API и к операциям с деньгами
+type RateLimitConfig struct {
+	Store          string
+	TrustedProxies []string
+	Public         RateLimit
+	Auth           RateLimit
+	User           RateLimit
+	Money          RateLimit
+	Login          LoginGuardConfig
+}
+
+// LoginGuardConfig содержит настройки защиты входа от подбора пароля.
+// Первые FreeAttempts неудачных попыток не ограничиваются, дальше следующая попытка откладывается
+// на BaseDelay, удваиваясь с каждой неудачей до MaxDelay. После LockoutThreshold неудач вход
+// блокируется на LockoutDuration. Счётчик сбрасывается успешным входом или через LockoutDuration без неудач
+type LoginGuardConfig struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+// MetricsConfig содержит настройки метрик Prometheus.
+// BusinessInterval - как часто пересчитываются бизнес-метрики (суммы балансов по валютам)
+type MetricsConfig struct {
+	BusinessInterval time.Duration
+}
+
+// TracingConfig содержит настройки трассировки OpenTelemetry.
+// Exporter - "otlp" (спаны отправляются по gRPC на OTLPEndpoint), "stdout" (печатаются в stdout) или "none".
+// При "none" спаны не записываются, но входящий traceparent всё равно передаётся обменнику.
+// SampleRatio - доля трассируемых запросов без входящего traceparent, от 0 до 1
+type TracingConfig struct {
+	Exporter     string
+	ServiceName  string
+	OTLPEndpoint string
+	OTLPInsecure bool
+	SampleRatio  float64
+}
+
+// HealthConfig содержит настройки проверок готовности.
+// CheckTimeout - сколько ждать ответа одной зависимости в /readyz,
+// ShutdownDelay - сколько /readyz отвечает 503 перед остановкой сервера, чтобы балансировщик успел убрать экземпляр
+type HealthConfig struct {
+	CheckTimeout  time.Duration
+	ShutdownDelay time.Duration
+}
+
+// CacheConfig содержит настройки кэша курсов валют в памяти.
+// TTL - сколько хранится запись, CleanupInterval - как часто удаляются истёкшие записи
+type CacheConfig struct {
+	TTL             time.Duration
+	CleanupInterval time.Duration
+}
+
+// File возвращает путь к файлу конфигурации: CONFIG_FILE или DefaultFile
+func File() string {
+	return getEnv("CONFIG_FILE", DefaultFile)
+}
+
+// LoadConfig загружает конфигурацию из переменных окружения и необязательного файла envPath в формате .env.
+// Если файла нет, используются только окружение и значения по умолчанию. Загруженная конфигурация проверяется Validate
 func LoadConfig(envPath string) (*Config, error) {
 	const op = "config.LoadConfig"
 
-	if err := godotenv.Load(envPath); err != nil {
-		return nil, fmt.Errorf("%s: ошибка загрузки .env файла: %w", op, err)
+	if err := godotenv.Load(envPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: ошибка загрузки файла конфигурации %s: %w", op, envPath, err)
 	}
 
-	connTimeout, err := strconv.Atoi(os.Getenv("DB_CONN_TIMEOUT"))
+	httpConfig, err := loadHTTPConfig()
 	if err != nil {
-		return nil, fmt.Errorf("%s: неверное значение для DB_CONN_TIMEOUT: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	postgresConfig := PostgresConfig{
+	postgresConfig, err := loadPostgresConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	grpcConfig, err := loadGRPCConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passwordConfig, err := loadPasswordConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	idempotencyTTL, err := getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ratesMaxAge, err := getEnvDuration("RATES_MAX_AGE", 5*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	quoteTTL, err := getEnvDuration("QUOTE_TTL", 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessTTL, err := getEnvDuration("ACCESS_TOKEN_TTL", 10*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refreshTTL, err := getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	jwtConfig, err := loadJWTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	mfaConfig, err := loadMFAConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	mailConfig, err := loadMailConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accountConfig, err := loadAccountConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rateLimitConfig, err := loadRateLimitConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	businessInterval, err := getEnvDuration("METRICS_BUSINESS_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tracingConfig, err := loadTracingConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	healthConfig, err := loadHealthConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cacheConfig, err := loadCacheConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cfg := &Config{
+		HTTP:        httpConfig,
+		Postgres:    postgresConfig,
+		GRPC:        grpcConfig,
+		Password:    passwordConfig,
+		Idempotency: IdempotencyConfig{TTL: idempotencyTTL},
+		Rates:       RatesConfig{MaxAge: ratesMaxAge, QuoteTTL: quoteTTL},
+		Session:     SessionConfig{AccessTTL: accessTTL, RefreshTTL: refreshTTL},
+		JWT:         jwtConfig,
+		MFA:         mfaConfig,
+		Mail:        mailConfig,
+		Account:     accountConfig,
+		RateLimit:   rateLimitConfig,
+		Metrics:     MetricsConfig{BusinessInterval: businessInterval},
+		Tracing:     tracingConfig,
+		Health:      healthConfig,
+		Cache:       cacheConfig,
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return cfg, nil
+}
+
+// loadHTTPConfig читает адрес и таймауты HTTP-сервера
+func loadHTTPConfig() (HTTPConfig, error) {
+	cfg := HTTPConfig{
+		Addr: getEnv("HTTP_ADDR", ":8080"),
+	}
+
+	var err error
+	if cfg.ReadHeaderTimeout, err = getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second); err != nil {
+		return HTTPConfig{}, err
+	}
+	if cfg.ReadTimeout, err = getEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second); err != nil {
+		return HTTPConfig{}, err
+	}
+	if cfg.WriteTimeout, err = getEnvDuration("HTTP_WRITE_TIMEOUT", 30*time.Second); err != nil {
+		return HTTPConfig{}, err
+	}
+	if cfg.IdleTimeout, err = getEnvDuration("HTTP_IDLE_TIMEOUT", time.Minute); err != nil {
+		return HTTPConfig{}, err
+	}
+	if cfg.ShutdownTimeout, err = getEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 5*time.Second); err != nil {
+		return HTTPConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadPostgresConfig читает параметры подключения к PostgreSQL и размер пула.
+// DB_CONN_TIMEOUT задаётся длительностью ("5s") или, как раньше, целым числом секунд
+func loadPostgresConfig() (PostgresConfig, error) {
+	cfg := PostgresConfig{
 		User:           os.Getenv("DB_USER"),
-		Password:       os.Getenv("DB_PASSWORD"),
 		Host:           os.Getenv("DB_HOST"),
-		Port:           os.Getenv("DB_PORT"),
+		Port:           getEnv("DB_PORT", "5432"),
 		Database:       os.Getenv("DB_NAME"),
-		ConnTimeout:    connTimeout,
-		MigrationsPath: os.Getenv("MIGRATIONS_PATH"),
+		MigrationsPath: getEnv("MIGRATIONS_PATH", "internal/storages/migrations"),
+	}
+
+	var err error
+	if cfg.Password, err = getEnvSecret("DB_PASSWORD"); err != nil {
+		return PostgresConfig{}, err
 	}
 
-	grpcConfig := GRPCConfig{
+	if seconds, err := strconv.Atoi(os.Getenv("DB_CONN_TIMEOUT")); err == nil {
+		if seconds <= 0 {
+			return PostgresConfig{}, fmt.Errorf("неверное значение для DB_CONN_TIMEOUT: должно быть больше нуля")
+		}
+		cfg.ConnTimeout = time.Duration(seconds) * time.Second
+	} else if cfg.ConnTimeout, err = getEnvDuration("DB_CONN_TIMEOUT", 10*time.Second); err != nil {
+		return PostgresConfig{}, err
+	}
+
+	if cfg.MaxConns, err = getEnvInt("DB_MAX_CONNS", 10); err != nil {
+		return PostgresConfig{}, err
+	}
+	if cfg.MinConns, err = getEnvInt("DB_MIN_CONNS", 0); err != nil {
+		return PostgresConfig{}, err
+	}
+	if cfg.MaxConnLifetime, err = getEnvDuration("DB_MAX_CONN_LIFETIME", time.Hour); err != nil {
+		return PostgresConfig{}, err
+	}
+	if cfg.MaxConnIdleTime, err = getEnvDuration("DB_MAX_CONN_IDLE_TIME", 30*time.Minute); err != nil {
+		return PostgresConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadGRPCConfig читает адрес обменника и параметры устойчивости клиента
+func loadGRPCConfig() (GRPCConfig, error) {
+	cfg := GRPCConfig{
 		Addr: os.Getenv("GRPC_ADDR"),
 	}
 
-	return &Config{
-		Postgres: postgresConfig,
-		GRPC:     grpcConfig,
-	}, nil
+	var err error
+	if cfg.CallTimeout, err = getEnvDuration("GRPC_CALL_TIMEOUT", 2*time.Second); err != nil {
+		return GRPCConfig{}, err
+	}
+	if cfg.MaxRetries, err = getEnvInt("GRPC_MAX_RETRIES", 2); err != nil {
+		return GRPCConfig{}, err
+	}
+	if cfg.RetryBackoff, err = getEnvDuration("GRPC_RETRY_BACKOFF", 100*time.Millisecond); err != nil {
+		return GRPCConfig{}, err
+	}
+	if cfg.RetryBackoffMax, err = getEnvDuration("GRPC_RETRY_BACKOFF_MAX", time.Second); err != nil {
+		return GRPCConfig{}, err
+	}
+	if cfg.BreakerThreshold, err = getEnvInt("GRPC_BREAKER_THRESHOLD", 5); err != nil {
+		return GRPCConfig{}, err
+	}
+	if cfg.BreakerCooldown, err = getEnvDuration("GRPC_BREAKER_COOLDOWN", 30*time.Second); err != nil {
+		return GRPCConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadPasswordConfig читает параметры хеширования паролей, подставляя значения по умолчанию.
+func loadPasswordConfig() (PasswordConfig, error) {
+	cfg := PasswordConfig{
+		Algorithm: getEnv("PASSWORD_HASH_ALGO", "bcrypt"),
+	}
+
+	var err error
+	if cfg.BcryptCost, err = getEnvInt("BCRYPT_COST", 10); err != nil {
+		return PasswordConfig{}, err
+	}
+	if cfg.Argon2Time, err = getEnvInt("ARGON2_TIME", 2); err != nil {
+		return PasswordConfig{}, err
+	}
+	if cfg.Argon2Memory, err = getEnvInt("ARGON2_MEMORY", 19456); err != nil {
+		return PasswordConfig{}, err
+	}
+	if cfg.Argon2Threads, err = getEnvInt("ARGON2_THREADS", 1); err != nil {
+		return PasswordConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadJWTConfig читает ключи подписи токенов. JWT_KEYS - список kid через запятую,
+// параметры каждого ключа задаются переменными JWT_KEY_<KID>_ALG, JWT_KEY_<KID>_SECRET (или JWT_KEY_<KID>_SECRET_FILE)
+// и JWT_KEY_<KID>_FILE с путём к PEM-файлу,
+// где <KID> - kid в верхнем регистре с заменой '-' и '.' на '_'
+func loadJWTConfig() (JWTConfig, error) {
+	cfg := JWTConfig{
+		Issuer:       getEnv("JWT_ISSUER", "gw-currency-wallet"),
+		Audience:     getEnv("JWT_AUDIENCE", "gw-currency-wallet"),
+		SigningKeyID: os.Getenv("JWT_SIGNING_KEY_ID"),
+	}
+
+	for _, id := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		prefix := jwtKeyPrefix(id)
+		secret, err := getEnvSecret(prefix + "SECRET")
+		if err != nil {
+			return JWTConfig{}, err
+		}
+		cfg.Keys = append(cfg.Keys, JWTKeyConfig{
+			ID:        id,
+			Algorithm: getEnv(prefix+"ALG", "HS256"),
+			Secret:    secret,
+			PEMFile:   os.Getenv(prefix + "FILE"),
+		})
+	}
+
+	if cfg.SigningKeyID == "" && len(cfg.Keys) > 0 {
+		cfg.SigningKeyID = cfg.Keys[0].ID
+	}
+
+	return cfg, nil
+}
+
+// jwtKeyPrefix префикс переменных окружения ключа: JWT_KEY_<KID>_
+func jwtKeyPrefix(id string) string {
+	return "JWT_KEY_" + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(id)) + "_"
+}
+
+// loadMFAConfig читает настройки TOTP. MFA_STEP_UP_THRESHOLDS - пороги вида "RUB:50000,USD:500",
+// операции в валютах без порога требуют свежего кода при любой сумме
+func loadMFAConfig() (MFAConfig, error) {
+	cfg := MFAConfig{
+		Issuer:           getEnv("MFA_ISSUER", "gw-currency-wallet"),
+		StepUpThresholds: make(map[string]decimal.Decimal),
+	}
+
+	var err error
+	if cfg.ChallengeTTL, err = getEnvDuration("MFA_CHALLENGE_TTL", 5*time.Minute); err != nil {
+		return MFAConfig{}, err
+	}
+	if cfg.StepUpMaxFailures, err = getEnvInt("MFA_STEP_UP_MAX_FAILURES", 5); err != nil {
+		return MFAConfig{}, err
+	}
+	if cfg.StepUpLockout, err = getEnvDuration("MFA_STEP_UP_LOCKOUT", 15*time.Minute); err != nil {
+		return MFAConfig{}, err
+	}
+
+	for _, pair := range strings.Split(os.Getenv("MFA_STEP_UP_THRESHOLDS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		currency, amount, ok := strings.Cut(pair, ":")
+		if !ok {
+			return MFAConfig{}, fmt.Errorf("неверное значение для MFA_STEP_UP_THRESHOLDS: %q", pair)
+		}
+		threshold, err := decimal.NewFromString(strings.TrimSpace(amount))
+		if err != nil || threshold.IsNegative() {
+			return MFAConfig{}, fmt.Errorf("неверное значение для MFA_STEP_UP_THRESHOLDS: %q", pair)
+		}
+		cfg.StepUpThresholds[strings.ToUpper(strings.TrimSpace(currency))] = threshold
+	}
+
+	return cfg, nil
+}
+
+// loadMailConfig читает настройки отправки писем. По умолчанию письма пишутся в лог
+func loadMailConfig() (MailConfig, error) {
+	cfg := MailConfig{
+		Driver:       getEnv("MAIL_DRIVER", "log"),
+		From:         getEnv("MAIL_FROM", "no-reply@gw-currency-wallet.local"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		Dir:          getEnv("MAIL_DIR", "mail"),
+	}
+
+	var err error
+	if cfg.SMTPPassword, err = getEnvSecret("SMTP_PASSWORD"); err != nil {
+		return MailConfig{}, err
+	}
+	if cfg.SendTimeout, err = getEnvDuration("MAIL_SEND_TIMEOUT", 10*time.Second); err != nil {
+		return MailConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadAccountConfig читает адреса и сроки действия ссылок подтверждения email и сброса пароля
+func loadAccountConfig() (AccountConfig, error) {
+	cfg := AccountConfig{
+		VerifyURL: getEnv("EMAIL_VERIFY_URL", "http://localhost:8080/api/v1/email/verify"),
+		ResetURL:  getEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password"),
+	}
+
+	var err error
+	if cfg.VerificationTTL, err = getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour); err != nil {
+		return AccountConfig{}, err
+	}
+	if cfg.ResetTTL, err = getEnvDuration("PASSWORD_RESET_TTL", time.Hour); err != nil {
+		return AccountConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadRateLimitConfig читает лимиты групп маршрутов (формат "60/1m", "off" отключает лимит)
+// и параметры защиты входа
+func loadRateLimitConfig() (RateLimitConfig, error) {
+	cfg := RateLimitConfig{
+		Store: getEnv("RATE_LIMIT_STORE", "memory"),
+	}
+
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, p)
+		}
+	}
+
+	var err error
+	if cfg.Public, err = getEnvRateLimit("RATE_LIMIT_PUBLIC", RateLimit{Requests: 60, Period: time.Minute}); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.Auth, err = getEnvRateLimit("RATE_LIMIT_AUTH", RateLimit{Requests: 10, Period: time.Minute}); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.User, err = getEnvRateLimit("RATE_LIMIT_USER", RateLimit{Requests: 300, Period: time.Minute}); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.Money, err = getEnvRateLimit("RATE_LIMIT_MONEY", RateLimit{Requests: 30, Period: time.Minute}); err != nil {
+		return RateLimitConfig{}, err
+	}
+
+	if cfg.Login.FreeAttempts, err = getEnvInt("LOGIN_FREE_ATTEMPTS", 3); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.Login.BaseDelay, err = getEnvDuration("LOGIN_DELAY_BASE", time.Second); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.Login.MaxDelay, err = getEnvDuration("LOGIN_DELAY_MAX", 30*time.Second); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.Login.LockoutThreshold, err = getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if cfg.Login.LockoutDuration, err = getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute); err != nil {
+		return RateLimitConfig{}, err
+	}
+
+	return cfg, nil
+}
+
+// getEnvRateLimit возвращает лимит вида "<запросов>/<период>", например "60/1m", или значение по умолчанию.
+// "off" и "0" отключают лимит
+func getEnvRateLimit(key string, def RateLimit) (RateLimit, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+	if v == "off" || v == "0" {
+		return RateLimit{}, nil
+	}
+
+	count, period, ok := strings.Cut(v, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("неверное значение для %s: %q", key, v)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("неверное значение для %s: %q", key, v)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("неверное значение для %s: %q", key, v)
+	}
+	return RateLimit{Requests: n, Period: d}, nil
+}
+
+// loadTracingConfig загружает настройки трассировки
+func loadTracingConfig() (TracingConfig, error) {
+	cfg := TracingConfig{
+		Exporter:     getEnv("TRACING_EXPORTER", "none"),
+		ServiceName:  getEnv("TRACING_SERVICE_NAME", "gw-currency-wallet"),
+		OTLPEndpoint: getEnv("TRACING_OTLP_ENDPOINT", "localhost:4317"),
+	}
+	var err error
+	if cfg.OTLPInsecure, err = getEnvBool("TRACING_OTLP_INSECURE", false); err != nil {
+		return TracingConfig{}, err
+	}
+	if cfg.SampleRatio, err = getEnvFloat("TRACING_SAMPLE_RATIO", 1); err != nil {
+		return TracingConfig{}, err
+	}
+	return cfg, nil
+}
+
+// loadHealthConfig загружает настройки проверок готовности
+func loadHealthConfig() (HealthConfig, error) {
+	var (
+		cfg HealthConfig
+		err error
+	)
+	if cfg.CheckTimeout, err = getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second); err != nil {
+		return HealthConfig{}, err
+	}
+	if cfg.ShutdownDelay, err = getEnvDuration("SHUTDOWN_DELAY", 5*time.Second); err != nil {
+		return HealthConfig{}, err
+	}
+	return cfg, nil
+}
+
+// loadCacheConfig загружает настройки кэша курсов валют
+func loadCacheConfig() (CacheConfig, error) {
+	var (
+		cfg CacheConfig
+		err error
+	)
+	if cfg.TTL, err = getEnvDuration("CACHE_TTL", 5*time.Minute); err != nil {
+		return CacheConfig{}, err
+	}
+	if cfg.CleanupInterval, err = getEnvDuration("CACHE_CLEANUP_INTERVAL", 10*time.Minute); err != nil {
+		return CacheConfig{}, err
+	}
+	return cfg, nil
+}
+
+// getEnv возвращает значение переменной окружения или значение по умолчанию.
+func getEnv(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// getEnvInt возвращает целочисленное значение переменной окружения или значение по умолчанию.
+func getEnvInt(key string, def int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение для %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// getEnvDuration возвращает длительность из переменной окружения (формат time.ParseDuration) или значение по умолчанию.
+func getEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение для %s: %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("неверное значение для %s: должно быть больше нуля", key)
+	}
+	return d, nil
+}
+
+// getEnvBool возвращает логическое значение переменной окружения (формат strconv.ParseBool) или значение по умолчанию.
+func getEnvBool(key string, def bool) (bool, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("неверное значение для %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// getEnvFloat возвращает дробное значение переменной окружения или значение по умолчанию.
+func getEnvFloat(key string, def float64) (float64, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("неверное значение для %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// getEnvSecret возвращает секрет из переменной окружения key или из файла, путь к которому задан в key_FILE
+// (так секреты передаются в Docker и Kubernetes). Завершающий перевод строки файла отбрасывается
+func getEnvSecret(key string) (string, error) {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return os.Getenv(key), nil
+	}
+	if os.Getenv(key) != "" {
+		return "", fmt.Errorf("заданы и %s, и %s_FILE: оставьте что-то одно", key, key)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("не удалось прочитать %s_FILE: %w", key, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
 }
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// Validate проверяет конфигурацию целиком и возвращает все найденные ошибки сразу,
+// чтобы при запуске их можно было исправить за один раз. В сообщениях указаны имена переменных окружения
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	// HTTP
+	_, _, err := net.SplitHostPort(c.HTTP.Addr)
+	check(err == nil, "HTTP_ADDR: ожидается адрес вида host:port или :port, получено %q", c.HTTP.Addr)
+
+	// PostgreSQL
+	check(c.Postgres.Host != "", "DB_HOST: не задан")
+	check(validPort(c.Postgres.Port), "DB_PORT: ожидается номер порта от 1 до 65535, получено %q", c.Postgres.Port)
+	check(c.Postgres.Database != "", "DB_NAME: не задан")
+	check(c.Postgres.User != "", "DB_USER: не задан")
+	check(c.Postgres.Password != "", "DB_PASSWORD: не задан (или задайте DB_PASSWORD_FILE)")
+	check(c.Postgres.MaxConns >= 1, "DB_MAX_CONNS: должно быть больше нуля")
+	check(c.Postgres.MinConns >= 0 && c.Postgres.MinConns <= c.Postgres.MaxConns,
+		"DB_MIN_CONNS: должно быть от 0 до DB_MAX_CONNS (%d)", c.Postgres.MaxConns)
+	if info, err := os.Stat(c.Postgres.MigrationsPath); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("MIGRATIONS_PATH: каталог %q не найден", c.Postgres.MigrationsPath))
+	}
+
+	// Обменник
+	check(c.GRPC.Addr != "", "GRPC_ADDR: не задан")
+	check(c.GRPC.MaxRetries >= 0, "GRPC_MAX_RETRIES: должно быть не меньше нуля")
+	check(c.GRPC.RetryBackoff <= c.GRPC.RetryBackoffMax, "GRPC_RETRY_BACKOFF: должно быть не больше GRPC_RETRY_BACKOFF_MAX")
+	check(c.GRPC.BreakerThreshold >= 1, "GRPC_BREAKER_THRESHOLD: должно быть больше нуля")
+
+	// Пароли и сессии
+	check(c.Password.Algorithm == "bcrypt" || c.Password.Algorithm == "argon2id",
+		"PASSWORD_HASH_ALGO: ожидается bcrypt или argon2id, получено %q", c.Password.Algorithm)
+	check(c.Session.AccessTTL < c.Session.RefreshTTL, "ACCESS_TOKEN_TTL: должно быть меньше REFRESH_TOKEN_TTL")
+
+	// JWT
+	check(len(c.JWT.Keys) > 0, "JWT_KEYS: не задано ни одного ключа")
+	if len(c.JWT.Keys) > 0 {
+		check(c.JWT.signingKey() != nil, "JWT_SIGNING_KEY_ID: ключ %q не перечислен в JWT_KEYS", c.JWT.SigningKeyID)
+	}
+	for _, k := range c.JWT.Keys {
+		prefix := jwtKeyPrefix(k.ID)
+		check(k.Secret != "" || k.PEMFile != "", "%sSECRET: не задан секрет ключа %q (или задайте %sSECRET_FILE, или %sFILE с PEM-файлом)",
+			prefix, k.ID, prefix, prefix)
+	}
+
+	// Второй фактор
+	check(c.MFA.StepUpMaxFailures >= 1, "MFA_STEP_UP_MAX_FAILURES: должно быть больше нуля")
+
+	// Письма и ссылки в них
+	switch c.Mail.Driver {
+	case "smtp":
+		check(c.Mail.SMTPHost != "", "SMTP_HOST: обязателен при MAIL_DRIVER=smtp")
+		check(validPort(c.Mail.SMTPPort), "SMTP_PORT: ожидается номер порта от 1 до 65535, получено %q", c.Mail.SMTPPort)
+	case "file":
+		check(c.Mail.Dir != "", "MAIL_DIR: обязателен при MAIL_DRIVER=file")
+	case "log":
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_DRIVER: ожидается smtp, file или log, получено %q", c.Mail.Driver))
+	}
+	check(absoluteURL(c.Account.VerifyURL), "EMAIL_VERIFY_URL: ожидается абсолютный URL, получено %q", c.Account.VerifyURL)
+	check(absoluteURL(c.Account.ResetURL), "PASSWORD_RESET_URL: ожидается абсолютный URL, получено %q", c.Account.ResetURL)
+
+	// Лимиты
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "postgres",
+		"RATE_LIMIT_STORE: ожидается memory или postgres, получено %q", c.RateLimit.Store)
+	check(c.RateLimit.Login.FreeAttempts >= 0, "LOGIN_FREE_ATTEMPTS: должно быть не меньше нуля")
+	check(c.RateLimit.Login.LockoutThreshold > c.RateLimit.Login.FreeAttempts,
+		"LOGIN_LOCKOUT_THRESHOLD: должно быть больше LOGIN_FREE_ATTEMPTS")
+	check(c.RateLimit.Login.BaseDelay <= c.RateLimit.Login.MaxDelay, "LOGIN_DELAY_BASE: должно быть не больше LOGIN_DELAY_MAX")
+
+	// Трассировка
+	switch c.Tracing.Exporter {
+	case "otlp":
+		check(c.Tracing.OTLPEndpoint != "", "TRACING_OTLP_ENDPOINT: обязателен при TRACING_EXPORTER=otlp")
+	case "stdout", "none":
+	default:
+		errs = append(errs, fmt.Errorf("TRACING_EXPORTER: ожидается otlp, stdout или none, получено %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO: должно быть от 0 до 1")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("неверная конфигурация:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted возвращает копию конфигурации для вывода в лог: заданные секреты заменены на "***".
+// В JSON секреты не попадают и без этого, копия защищает вывод через fmt
+func (c *Config) Redacted() Config {
+	r := *c
+	r.Postgres.Password = redact(r.Postgres.Password)
+	r.Mail.SMTPPassword = redact(r.Mail.SMTPPassword)
+
+	r.JWT.Keys = make([]JWTKeyConfig, len(c.JWT.Keys))
+	for i, k := range c.JWT.Keys {
+		k.Secret = redact(k.Secret)
+		r.JWT.Keys[i] = k
+	}
+	return r
+}
+
+// signingKey возвращает ключ, которым подписываются новые токены, или nil
+func (c *JWTConfig) signingKey() *JWTKeyConfig {
+	for i := range c.Keys {
+		if c.Keys[i].ID == c.SigningKeyID {
+			return &c.Keys[i]
+		}
+	}
+	return nil
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+func absoluteURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,105 @@
+package exchanger
+
+import (
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Состояния автоматического выключателя
+const (
+	StateClosed   = "closed"    // вызовы проходят
+	StateOpen     = "open"      // вызовы сразу отклоняются
+	StateHalfOpen = "half_open" // пропускается один пробный вызов
+)
+
+// breaker размыкается после threshold неудачных вызовов подряд и через cooldown
+// пропускает пробный вызов: успех замыкает цепь, неудача снова размыкает
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+	logger    *zap.Logger
+}
+
+func newBreaker(threshold int, cooldown time.Duration, logger *zap.Logger) *breaker {
+	return &breaker{
+		state:     StateClosed,
+		threshold: threshold,
+		cooldown:  cooldown,
+		logger:    logger,
+	}
+}
+
+// allow сообщает, можно ли выполнить вызов
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+	if b.state != StateClosed {
+		b.setState(StateClosed)
+	}
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+// release завершает вызов, не повлиявший на здоровье обменника (например, ошибка в запросе)
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) snapshot() (string, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state, b.failures
+}
+
+// setState вызывается под мьютексом
+func (b *breaker) setState(state string) {
+	b.logger.Warn("Exchanger circuit breaker state changed",
+		zap.String("from", b.state), zap.String("to", state), zap.Int("consecutive_failures", b.failures))
+	b.state = state
+}
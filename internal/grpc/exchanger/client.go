@@ -2,32 +2,159 @@ package exchanger
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	pb "github.com/galkin09/proto-exchange/exchange"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"os"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"gw-currency-wallet/internal/config"
+	"math/rand/v2"
+	"time"
 )
 
+// ErrCircuitOpen возвращается без обращения к обменнику, пока он считается нездоровым
+var ErrCircuitOpen = errors.New("exchanger is unavailable: circuit breaker is open")
+
+// ExchangerClient обёртка над gRPC-клиентом обменника: дедлайн на каждый вызов,
+// повторы с экспоненциальной задержкой для временных ошибок и автоматический выключатель
 type ExchangerClient struct {
-	pb.ExchangeServiceClient
+	client  pb.ExchangeServiceClient
+	conn    *grpc.ClientConn
+	cfg     config.GRPCConfig
+	breaker *breaker
+	logger  *zap.Logger
 }
 
-func NewExchangerClient() *ExchangerClient {
-	addr := os.Getenv("GRPC_ADDR")
-
-	conn, err := grpc.NewClient(addr)
-	if err != nil {
-		panic(err)
-	}
+// Health состояние обменника с точки зрения клиента
+type Health struct {
+	Breaker             string `json:"breaker"`
+	Connectivity        string `json:"connectivity"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
 
-	exchClient := pb.NewExchangeServiceClient(conn)
+func NewExchangerClient(conn *grpc.ClientConn, cfg config.GRPCConfig, logger *zap.Logger) *ExchangerClient {
+	logger = logger.With(zap.String("component", "exchanger"))
 
-	return &ExchangerClient{exchClient}
+	return &ExchangerClient{
+		client:  pb.NewExchangeServiceClient(conn),
+		conn:    conn,
+		cfg:     cfg,
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, logger),
+		logger:  logger,
+	}
 }
 
 func (e *ExchangerClient) GetExchangeRates(ctx context.Context, in *pb.Empty) (*pb.ExchangeRatesResponse, error) {
-	return e.ExchangeServiceClient.GetExchangeRates(ctx, in)
+	var resp *pb.ExchangeRatesResponse
+	err := e.call(ctx, "GetExchangeRates", func(ctx context.Context) error {
+		var err error
+		resp, err = e.client.GetExchangeRates(ctx, in)
+		return err
+	})
+	return resp, err
 }
 
 func (e *ExchangerClient) GetExchangeRateForCurrency(ctx context.Context, in *pb.CurrencyRequest) (*pb.ExchangeRateResponse, error) {
-	return e.ExchangeServiceClient.GetExchangeRateForCurrency(ctx, in)
+	var resp *pb.ExchangeRateResponse
+	err := e.call(ctx, "GetExchangeRateForCurrency", func(ctx context.Context) error {
+		var err error
+		resp, err = e.client.GetExchangeRateForCurrency(ctx, in)
+		return err
+	})
+	return resp, err
+}
+
+// Health возвращает состояние выключателя и соединения
+func (e *ExchangerClient) Health() Health {
+	state, failures := e.breaker.snapshot()
+	return Health{
+		Breaker:             state,
+		Connectivity:        e.conn.GetState().String(),
+		ConsecutiveFailures: failures,
+	}
+}
+
+// Ready проверяет, может ли клиент обращаться к обменнику: выключатель не разомкнут и соединение не в ошибке.
+// Простаивающее соединение (Idle) считается рабочим, проверка лишь запускает его установку:
+// клиент создаётся без подключения и соединяется при первом вызове
+func (e *ExchangerClient) Ready() error {
+	if state, _ := e.breaker.snapshot(); state == StateOpen {
+		return ErrCircuitOpen
+	}
+
+	switch state := e.conn.GetState(); state {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return fmt.Errorf("exchanger connection is %s", state)
+	case connectivity.Idle:
+		e.conn.Connect()
+	}
+	return nil
+}
+
+// call выполняет fn с дедлайном на каждую попытку и повторяет её при временных ошибках.
+// В выключатель попадает только итог вызова после всех повторов
+func (e *ExchangerClient) call(ctx context.Context, method string, fn func(ctx context.Context) error) error {
+	if !e.breaker.allow() {
+		return ErrCircuitOpen
+	}
+
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, e.cfg.CallTimeout)
+		err := fn(callCtx)
+		cancel()
+
+		if err == nil {
+			e.breaker.success()
+			return nil
+		}
+
+		if !retryable(err) {
+			e.breaker.release()
+			return err
+		}
+
+		// Отмена со стороны вызывающего не говорит о здоровье обменника
+		if ctx.Err() != nil {
+			e.breaker.release()
+			return err
+		}
+
+		if attempt >= e.cfg.MaxRetries {
+			e.breaker.failure()
+			return err
+		}
+
+		delay := e.backoff(attempt)
+		e.logger.Warn("Exchanger call failed, retrying",
+			zap.String("method", method), zap.Int("attempt", attempt+1), zap.Duration("delay", delay), zap.Error(err))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			e.breaker.release()
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff экспоненциальная задержка с полным джиттером, не больше RetryBackoffMax
+func (e *ExchangerClient) backoff(attempt int) time.Duration {
+	d := e.cfg.RetryBackoff << attempt
+	if d <= 0 || d > e.cfg.RetryBackoffMax {
+		d = e.cfg.RetryBackoffMax
+	}
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+// retryable временные ошибки, после которых имеет смысл повторить вызов
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/mailer"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ForgotPasswordRequest запрос письма со ссылкой для сброса пароля
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+}
+
+// ResetPasswordRequest новый пароль и токен из письма
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+// accountLink ссылка из письма: к базовому адресу добавляется параметр token
+func accountLink(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// sendAccountMail создаёт одноразовый токен с назначением purpose и отправляет письмо со ссылкой на него
+func (h *Handler) sendAccountMail(ctx context.Context, user storages.User, purpose string) error {
+	var (
+		base, subject, body string
+		ttl                 time.Duration
+	)
+	switch purpose {
+	case storages.TokenEmailVerification:
+		base, ttl = h.verifyURL, h.verificationTTL
+		subject = "Confirm your email address"
+		body = "Hello, %s!\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n" +
+			"The link is valid until %s. If you did not create an account, just ignore this email.\n"
+	case storages.TokenPasswordReset:
+		base, ttl = h.resetURL, h.resetTTL
+		subject = "Reset your password"
+		body = "Hello, %s!\n\nTo set a new password open the link below:\n\n%s\n\n" +
+			"The link is valid until %s. All active sessions will be signed out.\n" +
+			"If you did not request a password reset, just ignore this email.\n"
+	default:
+		return fmt.Errorf("unknown token purpose %q", purpose)
+	}
+
+	token, hash, err := auth.NewUserToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(ttl)
+	link, err := accountLink(base, token)
+	if err != nil {
+		return err
+	}
+
+	if err := h.storage.CreateUserToken(ctx, user.ID, purpose, hash, expiresAt); err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, user.Username, link, expiresAt.UTC().Format(time.RFC1123)),
+	})
+}
+
+// VerifyEmail godoc
+//
+//	@Summary      Verify email
+//	@Description  Подтверждает email по ссылке из письма. Ссылка одноразовая; новые права появляются
+//	@Description  в access-токене после входа или обновления по refresh-токену
+//	@Tags         users
+//	@Param        token query string true "Токен из письма"
+//	@Produce      json
+//	@Success      200
+//	@Failure      400 {object} problem.Problem
+//	@Router       /api/v1/email/verify [get]
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		problem.Respond(c, problem.CodeBadRequest, "token is required")
+		return
+	}
+
+	userID, err := h.storage.VerifyEmail(c, auth.HashUserToken(token))
+	if errors.Is(err, storages.ErrUserTokenInvalid) {
+		problem.Respond(c, problem.CodeBadRequest, storages.ErrUserTokenInvalid.Error())
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not verify email", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to verify email")
+		return
+	}
+
+	h.log(c).Info("Email verified", zap.Int("user_id", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification godoc
+//
+//	@Summary      Resend verification email
+//	@Description  Отправляет новое письмо для подтверждения email, ссылки из прежних писем перестают действовать
+//	@Tags         users
+//	@Param 		  Authorization header string true "JWT token"
+//	@Produce      json
+//	@Success      202
+//	@Failure      401 {object} problem.Problem
+//	@Failure      409 {object} problem.Problem
+//	@Router       /api/v1/email/verify/resend [post]
+func (h *Handler) ResendVerification(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.storage.GetUserByID(c, principal.UserID)
+	if err != nil {
+		h.log(c).Error("Could not get user", zap.Int("user_id", principal.UserID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to send email")
+		return
+	}
+	if user.EmailVerified {
+		problem.Respond(c, problem.CodeConflict, "email address is already verified")
+		return
+	}
+
+	if err := h.sendAccountMail(c, user, storages.TokenEmailVerification); err != nil {
+		h.log(c).Error("Could not send verification email", zap.Int("user_id", user.ID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to send email")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+// ForgotPassword godoc
+//
+//	@Summary      Forgot password
+//	@Description  Отправляет письмо со ссылкой для сброса пароля. Ответ всегда 202,
+//	@Description  чтобы по нему нельзя было узнать, зарегистрирован ли адрес
+//	@Tags         users
+//	@Param        input body ForgotPasswordRequest true "Email пользователя"
+//	@Accept       json
+//	@Produce      json
+//	@Success      202
+//	@Failure      400 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Router       /api/v1/password/forgot [post]
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	// Письмо отправляется в фоне: время ответа не зависит от того, есть ли такой пользователь
+	if !h.resetMail.push(resetMailJob{ctx: context.WithoutCancel(c.Request.Context()), email: req.Email}) {
+		h.log(c).Warn("Password reset email dropped: mail queue is full or closed")
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address is registered, a password reset email has been sent"})
+}
+
+// ResetPassword godoc
+//
+//	@Summary      Reset password
+//	@Description  Устанавливает новый пароль по токену из письма. Все сессии пользователя отзываются
+//	@Tags         users
+//	@Param        input body ResetPasswordRequest true "Токен из письма и новый пароль"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200
+//	@Failure      400 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Router       /api/v1/password/reset [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	hash, err := h.hasher.Hash(req.Password)
+	if err != nil {
+		h.log(c).Error("Could not hash password", zap.Error(err))
+		problem.Respond(c, problem.CodeBadRequest, "invalid password")
+		return
+	}
+
+	userID, err := h.storage.ResetPassword(c, auth.HashUserToken(req.Token), hash)
+	if errors.Is(err, storages.ErrUserTokenInvalid) {
+		problem.Respond(c, problem.CodeBadRequest, storages.ErrUserTokenInvalid.Error())
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not reset password", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to reset password")
+		return
+	}
+
+	h.log(c).Info("Password reset, sessions revoked", zap.Int("user_id", userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultAdminPageLimit = 20
+	maxAdminPageLimit     = 100
+)
+
+// UsersPage страница результатов поиска пользователей
+type UsersPage struct {
+	Users      []storages.UserSummary `json:"users"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// AuditPage страница журнала аудита
+type AuditPage struct {
+	Entries    []storages.AuditEntry `json:"entries"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// RoleRequest смена роли пользователя
+type RoleRequest struct {
+	Role   string `json:"role" example:"support"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// FreezeRequest причина заморозки или разморозки кошелька, необязательна
+type FreezeRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// audit записывает действие без изменения данных. Если запись не удалась, отвечает 500:
+// данные не выдаются без следа в журнале
+func (h *Handler) audit(c *gin.Context, entry storages.AuditEntry) bool {
+	if err := h.storage.RecordAudit(c, entry); err != nil {
+		h.log(c).Error("Could not record audit entry", zap.String("action", entry.Action), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to record audit entry")
+		return false
+	}
+	return true
+}
+
+// walletParam UUID кошелька из пути, при некорректном значении отвечает 400
+func walletParam(c *gin.Context) (string, bool) {
+	walletUUID := c.Param("uuid")
+	if _, err := uuid.Parse(walletUUID); err != nil {
+		problem.Respond(c, problem.CodeBadRequest, "invalid wallet uuid")
+		return "", false
+	}
+	return walletUUID, true
+}
+
+// pageLimit размер страницы из параметра limit
+func pageLimit(c *gin.Context) (int, error) {
+	v := c.Query("limit")
+	if v == "" {
+		return defaultAdminPageLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxAdminPageLimit {
+		return 0, errInvalidParam("limit")
+	}
+	return limit, nil
+}
+
+// checkReason проверяет длину необязательной причины
+func checkReason(reason string) error {
+	if utf8.RuneCountInString(reason) > maxMemoLen {
+		return errors.New("reason is too long")
+	}
+	return nil
+}
+
+// AdminSearchUsers godoc
+//
+//	@Summary      Search users
+//	@Description  Поиск пользователей по подстроке имени или email и по роли. Требует права users:read
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        q query string false "Подстрока имени или email"
+//	@Param        role query string false "user, support или admin"
+//	@Param        cursor query string false "Курсор из next_cursor"
+//	@Param        limit query int false "Размер страницы, по умолчанию 20, максимум 100"
+//	@Produce      json
+//	@Success      200 {object} UsersPage
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Router       /api/v1/admin/users [get]
+func (h *Handler) AdminSearchUsers(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	filter := storages.UserFilter{Query: strings.TrimSpace(c.Query("q")), Role: c.Query("role")}
+	if filter.Role != "" && !auth.KnownRole(filter.Role) {
+		problem.Respond(c, problem.CodeBadRequest, errInvalidParam("role").Error())
+		return
+	}
+
+	limit, err := pageLimit(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeBadRequest, err.Error())
+		return
+	}
+	if v := c.Query("cursor"); v != "" {
+		id, err := decodeCursor(v)
+		if err != nil {
+			problem.Respond(c, problem.CodeBadRequest, errInvalidParam("cursor").Error())
+			return
+		}
+		filter.AfterID = int(id)
+	}
+	// На одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit = limit + 1
+
+	users, err := h.storage.SearchUsers(c, filter)
+	if err != nil {
+		h.log(c).Error("Could not search users", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to search users")
+		return
+	}
+
+	details := map[string]any{"q": filter.Query, "role": filter.Role}
+	if !h.audit(c, storages.AuditEntry{ActorID: principal.UserID, Action: storages.AuditUserSearch, Details: details}) {
+		return
+	}
+
+	page := UsersPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = encodeCursor(int64(page.Users[limit-1].ID))
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// AdminSetUserRole godoc
+//
+//	@Summary      Change user role
+//	@Description  Меняет роль пользователя и завершает его сессии. Требует права users:manage
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        id path int true "ID пользователя"
+//	@Param		  role body RoleRequest true "Новая роль"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Router       /api/v1/admin/users/{id}/role [put]
+func (h *Handler) AdminSetUserRole(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID < 1 {
+		problem.Respond(c, problem.CodeBadRequest, "invalid user id")
+		return
+	}
+
+	var req RoleRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+	if !auth.KnownRole(req.Role) {
+		problem.Respond(c, problem.CodeBadRequest, "unknown role")
+		return
+	}
+	if err := checkReason(req.Reason); err != nil {
+		problem.Respond(c, problem.CodeBadRequest, err.Error())
+		return
+	}
+	// Иначе последний администратор может случайно лишить себя доступа
+	if userID == principal.UserID {
+		problem.Respond(c, problem.CodeBadRequest, "cannot change own role")
+		return
+	}
+
+	err = h.storage.SetUserRole(c, userID, req.Role, storages.AuditEntry{
+		ActorID:      principal.UserID,
+		Action:       storages.AuditUserRole,
+		TargetUserID: userID,
+		Reason:       req.Reason,
+		Details:      map[string]any{"role": req.Role},
+	})
+	if errors.Is(err, storages.ErrUserNotFound) {
+		problem.Respond(c, problem.CodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not change user role", zap.Int("user_id", userID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to change role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role changed successfully"})
+}
+
+// AdminGetWallet godoc
+//
+//	@Summary      View wallet
+//	@Description  Кошелёк любого пользователя с балансами. Требует права wallets:read
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        uuid path string true "UUID кошелька"
+//	@Produce      json
+//	@Success      200 {object} storages.Wallet
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Router       /api/v1/admin/wallets/{uuid} [get]
+func (h *Handler) AdminGetWallet(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+	walletUUID, ok := walletParam(c)
+	if !ok {
+		return
+	}
+
+	wallet, err := h.storage.GetWallet(c, walletUUID)
+	if err != nil {
+		h.log(c).Error("Could not get wallet", zap.String("wallet_uuid", walletUUID), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	if !h.audit(c, storages.AuditEntry{ActorID: principal.UserID, Action: storages.AuditWalletView, TargetWalletUUID: walletUUID}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// AdminWalletTransactions godoc
+//
+//	@Summary      Wallet transaction history
+//	@Description  История операций любого кошелька, параметры как у /api/v1/transactions. Требует права wallets:read
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        uuid path string true "UUID кошелька"
+//	@Param        type query string false "deposit, withdraw, exchange, transfer_out, transfer_in или adjustment"
+//	@Param        currency query string false "Код валюты (списания или зачисления)"
+//	@Param        from query string false "Начало периода, RFC 3339"
+//	@Param        to query string false "Конец периода (не включая), RFC 3339"
+//	@Param        cursor query string false "Курсор из next_cursor"
+//	@Param        limit query int false "Размер страницы, по умолчанию 20, максимум 100"
+//	@Produce      json
+//	@Success      200 {object} TransactionsPage
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Router       /api/v1/admin/wallets/{uuid}/transactions [get]
+func (h *Handler) AdminWalletTransactions(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+	walletUUID, ok := walletParam(c)
+	if !ok {
+		return
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeBadRequest, err.Error())
+		return
+	}
+	limit := filter.Limit
+	filter.Limit++
+
+	// История несуществующего кошелька пуста, поэтому кошелёк проверяется отдельно
+	if _, err := h.storage.GetWallet(c, walletUUID); err != nil {
+		h.log(c).Error("Could not get wallet", zap.String("wallet_uuid", walletUUID), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	transactions, err := h.storage.ListTransactions(c, walletUUID, filter)
+	if err != nil {
+		h.log(c).Error("Could not list transactions", zap.String("wallet_uuid", walletUUID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to list transactions")
+		return
+	}
+
+	if !h.audit(c, storages.AuditEntry{ActorID: principal.UserID, Action: storages.AuditWalletHistory, TargetWalletUUID: walletUUID}) {
+		return
+	}
+
+	page := TransactionsPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeCursor(page.Transactions[limit-1].ID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// AdminFreezeWallet godoc
+//
+//	@Summary      Freeze wallet
+//	@Description  Замораживает кошелёк: пользователь не может пополнять, снимать, обменивать, отправлять и получать средства. Требует права wallets:freeze
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        uuid path string true "UUID кошелька"
+//	@Param		  reason body FreezeRequest false "Причина"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200 {object} storages.Wallet
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Router       /api/v1/admin/wallets/{uuid}/freeze [post]
+func (h *Handler) AdminFreezeWallet(c *gin.Context) {
+	h.setWalletFrozen(c, true)
+}
+
+// AdminUnfreezeWallet godoc
+//
+//	@Summary      Unfreeze wallet
+//	@Description  Снимает заморозку с кошелька. Требует права wallets:freeze
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        uuid path string true "UUID кошелька"
+//	@Param		  reason body FreezeRequest false "Причина"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200 {object} storages.Wallet
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Router       /api/v1/admin/wallets/{uuid}/unfreeze [post]
+func (h *Handler) AdminUnfreezeWallet(c *gin.Context) {
+	h.setWalletFrozen(c, false)
+}
+
+func (h *Handler) setWalletFrozen(c *gin.Context, frozen bool) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+	walletUUID, ok := walletParam(c)
+	if !ok {
+		return
+	}
+
+	// Тело необязательно
+	var req FreezeRequest
+	if c.Request.ContentLength != 0 {
+		if !h.bindJSON(c, &req) {
+			return
+		}
+	}
+	if err := checkReason(req.Reason); err != nil {
+		problem.Respond(c, problem.CodeBadRequest, err.Error())
+		return
+	}
+
+	action := storages.AuditWalletUnfreeze
+	if frozen {
+		action = storages.AuditWalletFreeze
+	}
+
+	wallet, err := h.storage.SetWalletFrozen(c, walletUUID, frozen, storages.AuditEntry{
+		ActorID:          principal.UserID,
+		Action:           action,
+		TargetWalletUUID: walletUUID,
+		Reason:           req.Reason,
+	})
+	if err != nil {
+		h.log(c).Error("Could not change wallet freeze", zap.String("wallet_uuid", walletUUID), zap.Bool("frozen", frozen), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// AdminAdjustWallet godoc
+//
+//	@Summary      Manual balance adjustment
+//	@Description  Ручная корректировка баланса: amount > 0 зачисляет, amount < 0 списывает. Причина обязательна. Требует права wallets:adjust
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param 		  Idempotency-Key header string false "Ключ идемпотентности: повтор с тем же ключом вернёт первый ответ"
+//	@Param        uuid path string true "UUID кошелька"
+//	@Param		  adjustment body storages.Adjustment true "Корректировка"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200 {object} storages.Wallet
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Failure      413 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Router       /api/v1/admin/wallets/{uuid}/adjustments [post]
+func (h *Handler) AdminAdjustWallet(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+	walletUUID, ok := walletParam(c)
+	if !ok {
+		return
+	}
+
+	var adj storages.Adjustment
+	if !h.bindJSON(c, &adj) {
+		return
+	}
+
+	wallet, err := h.storage.AdjustWallet(c, walletUUID, adj, storages.AuditEntry{
+		ActorID:          principal.UserID,
+		Action:           storages.AuditWalletAdjust,
+		TargetWalletUUID: walletUUID,
+		Reason:           adj.Reason,
+		Details:          map[string]any{"currency": adj.Currency, "amount": adj.Amount.String()},
+	})
+	if err != nil {
+		h.log(c).Error("Could not adjust wallet", zap.String("wallet_uuid", walletUUID), zap.String("currency", adj.Currency), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	h.log(c).Info("Wallet adjusted", zap.Int("actor_id", principal.UserID), zap.String("wallet_uuid", walletUUID),
+		zap.String("currency", adj.Currency), zap.String("amount", adj.Amount.String()))
+
+	c.JSON(http.StatusOK, wallet)
+}
+
+// AdminAuditLog godoc
+//
+//	@Summary      Audit log
+//	@Description  Журнал действий в административном API от новых к старым. Требует права audit:read
+//	@Tags         admin
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        actor_id query int false "ID сотрудника"
+//	@Param        wallet_uuid query string false "UUID кошелька"
+//	@Param        action query string false "Действие, например wallet.adjust"
+//	@Param        cursor query string false "Курсор из next_cursor"
+//	@Param        limit query int false "Размер страницы, по умолчанию 20, максимум 100"
+//	@Produce      json
+//	@Success      200 {object} AuditPage
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Router       /api/v1/admin/audit [get]
+func (h *Handler) AdminAuditLog(c *gin.Context) {
+	filter := storages.AuditFilter{
+		TargetWalletUUID: c.Query("wallet_uuid"),
+		Action:           c.Query("action"),
+	}
+
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			problem.Respond(c, problem.CodeBadRequest, errInvalidParam("actor_id").Error())
+			return
+		}
+		filter.ActorID = id
+	}
+
+	limit, err := pageLimit(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeBadRequest, err.Error())
+		return
+	}
+	if v := c.Query("cursor"); v != "" {
+		id, err := decodeCursor(v)
+		if err != nil {
+			problem.Respond(c, problem.CodeBadRequest, errInvalidParam("cursor").Error())
+			return
+		}
+		filter.AfterID = id
+	}
+	filter.Limit = limit + 1
+
+	entries, err := h.storage.ListAuditLog(c, filter)
+	if err != nil {
+		h.log(c).Error("Could not list audit log", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to list audit log")
+		return
+	}
+
+	page := AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = encodeCursor(page.Entries[limit-1].ID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/problem"
+	"net/http"
+)
+
+// ListCurrencies godoc
+//
+//	@Summary      Currencies
+//	@Description  Справочник доступных валют: код, количество знаков после запятой и название
+//	@Tags         wallets
+//	@Produce      json
+//	@Success      200 {array} storages.Currency
+//	@Failure      500 {object} problem.Problem
+//	@Router       /api/v1/currencies [get]
+func (h *Handler) ListCurrencies(c *gin.Context) {
+	currencies, err := h.storage.ListCurrencies(c)
+	if err != nil {
+		h.log(c).Error("Could not list currencies", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to list currencies")
+		return
+	}
+
+	c.JSON(http.StatusOK, currencies)
+}
@@ -2,33 +2,122 @@ package handlers
 
 import (
 	"context"
-	pb "github.com/galkin09/proto-exchange/exchange"
+	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/config"
+	"gw-currency-wallet/internal/grpc/exchanger"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/mailer"
+	"gw-currency-wallet/internal/metrics"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/ratelimit"
 	"gw-currency-wallet/internal/storages"
-	"gw-currency-wallet/internal/storages/postgres"
+	"gw-currency-wallet/internal/validation"
 	"time"
 )
 
 type Handler struct {
 	storage storages.Storage
-	exch    pb.ExchangeServiceClient
+	exch    *exchanger.ExchangerClient
 	logger  *zap.Logger
 	cache   *cache.Cache
+	hasher  *auth.PasswordHasher
+	tokens  *auth.KeySet
+	mailer  mailer.Mailer
+	// loginGuard откладывает и блокирует вход после неудачных попыток, stepUpGuard - step-up после неверных кодов TOTP
+	loginGuard  *ratelimit.LoginGuard
+	stepUpGuard *ratelimit.LoginGuard
+	// resetMail очередь писем для сброса пароля, её разбирает RunMailQueue
+	resetMail *resetMailQueue
+	// metrics счётчики операций с деньгами
+	metrics *metrics.Metrics
+
+	// maxRateAge максимальный возраст сохранённого курса, по которому ещё можно проводить обмен
+	maxRateAge time.Duration
+	// quoteTTL срок действия котировки обмена
+	quoteTTL time.Duration
+	// accessTTL срок действия access-токена, refreshTTL - refresh-токена
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	// mfaIssuer название сервиса в приложении-аутентификаторе, mfaChallengeTTL - срок токена второго шага входа
+	mfaIssuer       string
+	mfaChallengeTTL time.Duration
+	// stepUpThresholds суммы по валютам, начиная с которых снятие и перевод требуют свежего кода TOTP
+	stepUpThresholds map[string]decimal.Decimal
+	// verifyURL и resetURL адреса ссылок из писем, verificationTTL и resetTTL - сроки их действия
+	verifyURL       string
+	resetURL        string
+	verificationTTL time.Duration
+	resetTTL        time.Duration
 }
 
-func NewHandler(ctx context.Context, logger *zap.Logger, dbURL string, migrationsPath string,
-	exchangeClient pb.ExchangeServiceClient, c *cache.Cache) (*Handler, error) {
-	psql := postgres.NewPSQL(logger)
-	if err := psql.Start(ctx, dbURL, 10*time.Second, migrationsPath); err != nil {
-		logger.Error("Failed to initialize PostgreSQL", zap.Error(err))
-		return nil, err
+func NewHandler(logger *zap.Logger, cfg *config.Config, storage storages.Storage, exchangeClient *exchanger.ExchangerClient,
+	c *cache.Cache, hasher *auth.PasswordHasher, tokens *auth.KeySet, m mailer.Mailer, guard *ratelimit.LoginGuard,
+	stepUpGuard *ratelimit.LoginGuard, mt *metrics.Metrics) *Handler {
+	return &Handler{
+		storage:     storage,
+		exch:        exchangeClient,
+		logger:      logger,
+		cache:       c,
+		hasher:      hasher,
+		tokens:      tokens,
+		mailer:      m,
+		loginGuard:  guard,
+		stepUpGuard: stepUpGuard,
+		resetMail:   newResetMailQueue(),
+		metrics:     mt,
+		maxRateAge:  cfg.Rates.MaxAge,
+		quoteTTL:    cfg.Rates.QuoteTTL,
+		accessTTL:   cfg.Session.AccessTTL,
+		refreshTTL:  cfg.Session.RefreshTTL,
+
+		mfaIssuer:        cfg.MFA.Issuer,
+		mfaChallengeTTL:  cfg.MFA.ChallengeTTL,
+		stepUpThresholds: cfg.MFA.StepUpThresholds,
+
+		verifyURL:       cfg.Account.VerifyURL,
+		resetURL:        cfg.Account.ResetURL,
+		verificationTTL: cfg.Account.VerificationTTL,
+		resetTTL:        cfg.Account.ResetTTL,
 	}
+}
 
-	return &Handler{
-		storage: psql,
-		exch:    exchangeClient,
-		logger:  logger,
-		cache:   c,
-	}, nil
+// log логгер запроса из ctx: записи содержат request ID, маршрут, пользователя и трассу
+func (h *Handler) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, h.logger)
+}
+
+// principal пользователь запроса из access-токена. Если его нет, отвечает 401 и возвращает ok == false
+func (h *Handler) principal(c *gin.Context) (auth.Principal, bool) {
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		h.log(c).Error("Principal not found in context")
+		problem.Respond(c, problem.CodeUnauthorized, "user not authenticated")
+	}
+	return p, ok
+}
+
+// bindJSON разбирает тело запроса в obj и проверяет его по тегам binding.
+// Неразборчивое тело - 400, нарушения правил - 422 со списком полей. При ошибке возвращает false
+func (h *Handler) bindJSON(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	if fields, ok := validation.Errors(err); ok {
+		h.log(c).Info("Request validation failed", zap.Any("fields", fields))
+		p := problem.New(problem.CodeValidationFailed, "request validation failed")
+		p.Errors = fields
+		problem.Abort(c, p)
+		return false
+	}
+
+	// Текст ошибки разбора описывает типы Go, клиенту он не нужен
+	h.log(c).Info("Could not bind JSON", zap.Error(err))
+	problem.Respond(c, problem.CodeBadRequest, "malformed request body")
+	return false
 }
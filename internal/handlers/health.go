@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gw-currency-wallet/internal/grpc/exchanger"
+	"net/http"
+)
+
+// ExchangerHealth godoc
+//
+//	@Summary      Exchanger health
+//	@Description  Состояние автоматического выключателя и соединения с обменником. 503, пока выключатель разомкнут
+//	@Tags         health
+//	@Produce      json
+//	@Success      200 {object} exchanger.Health
+//	@Failure      503 {object} exchanger.Health
+//	@Router       /health/exchanger [get]
+func (h *Handler) ExchangerHealth(c *gin.Context) {
+	health := h.exch.Health()
+
+	status := http.StatusOK
+	if health.Breaker == exchanger.StateOpen {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, health)
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// JWKS godoc
+//
+//	@Summary      JSON Web Key Set
+//	@Description  Открытые ключи для проверки access-токенов другими сервисами. Ключ выбирается по kid из заголовка токена
+//	@Tags         auth
+//	@Produce      json
+//	@Success      200 {object} auth.JWKS
+//	@Router       /.well-known/jwks.json [get]
+func (h *Handler) JWKS(c *gin.Context) {
+	// Короткое кэширование: после ротации новый ключ должен появиться у клиентов быстро
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/storages"
+	"sync"
+	"time"
+)
+
+const (
+	// resetMailQueueSize сколько запросов сброса пароля может ждать отправки. Сверх этого запросы отбрасываются
+	resetMailQueueSize = 256
+	// resetMailTimeout сколько может занять поиск пользователя и отправка одного письма
+	resetMailTimeout = 30 * time.Second
+)
+
+// resetMailJob запрос письма для сброса пароля. ctx - контекст запроса без отмены, из него берутся поля лога
+type resetMailJob struct {
+	ctx   context.Context
+	email string
+}
+
+// resetMailQueue ограниченная очередь писем для сброса пароля. Её разбирает RunMailQueue,
+// после CloseMailQueue новые запросы не принимаются
+type resetMailQueue struct {
+	mu     sync.Mutex
+	closed bool
+	jobs   chan resetMailJob
+}
+
+func newResetMailQueue() *resetMailQueue {
+	return &resetMailQueue{jobs: make(chan resetMailJob, resetMailQueueSize)}
+}
+
+// push ставит запрос в очередь без ожидания. false - очередь полна или уже закрыта
+func (q *resetMailQueue) push(job resetMailJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *resetMailQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+}
+
+// RunMailQueue отправляет письма из очереди, пока она не закрыта, и возвращается, отправив всё, что в ней осталось.
+// Запускается в фоне и должен завершиться до закрытия пула PostgreSQL
+func (h *Handler) RunMailQueue() {
+	for job := range h.resetMail.jobs {
+		h.sendPasswordReset(job.ctx, job.email)
+	}
+}
+
+// CloseMailQueue перестаёт принимать запросы писем. Вызывается после остановки HTTP-сервера,
+// чтобы RunMailQueue дослал очередь и завершился
+func (h *Handler) CloseMailQueue() {
+	h.resetMail.close()
+}
+
+// sendPasswordReset ищет пользователя по email и отправляет ему письмо для сброса пароля
+func (h *Handler) sendPasswordReset(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, resetMailTimeout)
+	defer cancel()
+
+	user, err := h.storage.GetUserByEmail(ctx, email)
+	if errors.Is(err, storages.ErrUserNotFound) {
+		h.log(ctx).Info("Password reset requested for unknown email")
+		return
+	}
+	if err != nil {
+		h.log(ctx).Error("Could not get user", zap.Error(err))
+		return
+	}
+
+	if err := h.sendAccountMail(ctx, user, storages.TokenPasswordReset); err != nil {
+		h.log(ctx).Error("Could not send password reset email", zap.Int("user_id", user.ID), zap.Error(err))
+		return
+	}
+	h.log(ctx).Info("Password reset email sent", zap.Int("user_id", user.ID))
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/ratelimit"
+	"gw-currency-wallet/internal/requestbody"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTPHeader заголовок со свежим кодом TOTP для операций выше порога
+const TOTPHeader = "X-TOTP-Code"
+
+// TOTPEnrollResponse секрет TOTP и URI для QR-кода
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TOTPCodeRequest код из приложения-аутентификатора
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
+
+// RecoveryCodesResponse одноразовые коды восстановления, показываются один раз
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallengeResponse ответ на вход пользователя с включённым TOTP: пароль верен,
+// токены выдаются после /api/v1/login/mfa
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MFALoginRequest второй шаг входа: код TOTP или код восстановления
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code,omitempty" binding:"required_without=RecoveryCode,excluded_with=RecoveryCode,omitempty,len=6,numeric" example:"123456"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// verifyTOTP проверяет код пользователя и запоминает его шаг, чтобы код нельзя было использовать повторно
+func (h *Handler) verifyTOTP(ctx context.Context, userID int, code string) error {
+	totp, err := h.storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Confirmed {
+		return storages.ErrMFANotEnrolled
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, totp.LastStep, time.Now())
+	if !ok {
+		return storages.ErrTOTPInvalid
+	}
+	return h.storage.UseTOTPStep(ctx, userID, step)
+}
+
+// startMFAChallenge выдаёт токен второго шага входа вместо пары токенов сессии
+func (h *Handler) startMFAChallenge(c *gin.Context, user storages.User) {
+	token, hash, err := auth.NewMFAChallengeToken()
+	if err != nil {
+		h.log(c).Error("Could not generate mfa challenge", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	expiresAt := time.Now().Add(h.mfaChallengeTTL)
+	if err := h.storage.CreateMFAChallenge(c, user.ID, hash, expiresAt); err != nil {
+		h.log(c).Error("Could not store mfa challenge", zap.Int("user_id", user.ID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	h.log(c).Info("Password accepted, waiting for second factor", zap.Int("user_id", user.ID))
+	c.JSON(http.StatusOK, MFAChallengeResponse{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt})
+}
+
+// EnrollTOTP godoc
+//
+//	@Summary      Enroll TOTP
+//	@Description  Выдаёт секрет TOTP и otpauth:// URI для приложения-аутентификатора. Второй фактор включается
+//	@Description  после подтверждения первым кодом в /api/v1/mfa/totp/confirm
+//	@Tags         mfa
+//	@Param 		  Authorization header string true "JWT token"
+//	@Produce      json
+//	@Success      200 {object} TOTPEnrollResponse
+//	@Failure      401 {object} problem.Problem
+//	@Failure      409 {object} problem.Problem
+//	@Router       /api/v1/mfa/totp/enroll [post]
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.storage.GetUserByID(c, principal.UserID)
+	if err != nil {
+		h.log(c).Error("Could not get user", zap.Int("user_id", principal.UserID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to enroll")
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		h.log(c).Error("Could not generate totp secret", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to enroll")
+		return
+	}
+
+	err = h.storage.EnrollTOTP(c, user.ID, secret)
+	if errors.Is(err, storages.ErrMFAAlreadyEnabled) {
+		problem.Error(c, storages.ErrMFAAlreadyEnabled)
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not store totp secret", zap.Int("user_id", user.ID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to enroll")
+		return
+	}
+
+	c.JSON(http.StatusOK, TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(h.mfaIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP godoc
+//
+//	@Summary      Confirm TOTP
+//	@Description  Включает второй фактор по первому коду из приложения и выдаёт одноразовые коды восстановления
+//	@Tags         mfa
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        input body TOTPCodeRequest true "Код из приложения"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200 {object} RecoveryCodesResponse
+//	@Failure      400 {object} problem.Problem
+//	@Failure      401 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Router       /api/v1/mfa/totp/confirm [post]
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	var req TOTPCodeRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	totp, err := h.storage.GetTOTP(c, principal.UserID)
+	if errors.Is(err, storages.ErrMFANotEnrolled) {
+		problem.Respond(c, problem.CodeNotFound, "totp enrollment not found")
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not get totp", zap.Int("user_id", principal.UserID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to confirm")
+		return
+	}
+	if totp.Confirmed {
+		problem.Error(c, storages.ErrMFAAlreadyEnabled)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, req.Code, totp.LastStep, time.Now())
+	if !ok {
+		problem.Respond(c, problem.CodeBadRequest, storages.ErrTOTPInvalid.Error())
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		h.log(c).Error("Could not generate recovery codes", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to confirm")
+		return
+	}
+
+	err = h.storage.ConfirmTOTP(c, principal.UserID, step, hashes)
+	if errors.Is(err, storages.ErrTOTPInvalid) {
+		problem.Respond(c, problem.CodeBadRequest, storages.ErrTOTPInvalid.Error())
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not confirm totp", zap.Int("user_id", principal.UserID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to confirm")
+		return
+	}
+
+	h.log(c).Info("Two-factor authentication enabled", zap.Int("user_id", principal.UserID))
+	c.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// LoginMFA godoc
+//
+//	@Summary      Login second factor
+//	@Description  Второй шаг входа: mfa_token из /api/v1/login и код TOTP или код восстановления.
+//	@Description  После нескольких неверных кодов токен перестаёт действовать
+//	@Tags         users
+//	@Param        input body MFALoginRequest true "Токен и код"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200 {object} TokenResponse
+//	@Failure      400 {object} problem.Problem
+//	@Failure      401 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Router       /api/v1/login/mfa [post]
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	hash := auth.HashMFAChallengeToken(req.MFAToken)
+
+	userID, err := h.storage.GetMFAChallenge(c, hash)
+	if errors.Is(err, storages.ErrMFAChallengeInvalid) {
+		problem.Respond(c, problem.CodeUnauthorized, "invalid mfa token")
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not get mfa challenge", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		err = h.storage.UseRecoveryCode(c, userID, auth.HashRecoveryCode(req.RecoveryCode))
+	} else {
+		err = h.verifyTOTP(c, userID, req.Code)
+	}
+	if errors.Is(err, storages.ErrTOTPInvalid) {
+		if err := h.storage.FailMFAChallenge(c, hash); err != nil {
+			h.log(c).Error("Could not count failed mfa attempt", zap.Error(err))
+		}
+		h.log(c).Info("Login failed: wrong second factor", zap.Int("user_id", userID))
+		problem.Respond(c, problem.CodeUnauthorized, storages.ErrTOTPInvalid.Error())
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not verify second factor", zap.Int("user_id", userID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	user, err := h.storage.CompleteMFAChallenge(c, hash)
+	if errors.Is(err, storages.ErrMFAChallengeInvalid) {
+		problem.Respond(c, problem.CodeUnauthorized, "invalid mfa token")
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not complete mfa challenge", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	tokens, err := h.startSession(c, user)
+	if err != nil {
+		h.log(c).Error("login Error", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	h.log(c).Info("Successfully logged in with second factor", zap.Int("user_id", user.ID))
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RequireFreshTOTP для снятий и переводов от порога MFA_STEP_UP_THRESHOLDS требует свежий код TOTP
+// в заголовке X-TOTP-Code даже при действующей сессии. Для валюты без порога (например, недавно добавленной
+// в справочник) код требуется при любой сумме. Пользователей без второго фактора не касается.
+// Попытки с кодом учитываются stepUpGuard: после MFA_STEP_UP_MAX_FAILURES неверных кодов подряд - 429 account_locked.
+// Стоит перед idempotency.Middleware, чтобы отказ без кода не сохранялся как ответ на ключ
+func (h *Handler) RequireFreshTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := requestbody.Read(c)
+		if !ok {
+			return
+		}
+
+		// Некорректное тело отклонит обработчик
+		var op struct {
+			Amount   decimal.Decimal `json:"amount"`
+			Currency string          `json:"currency"`
+		}
+		if err := json.Unmarshal(body, &op); err != nil {
+			c.Next()
+			return
+		}
+		threshold, ok := h.stepUpThresholds[strings.ToUpper(op.Currency)]
+		if ok && op.Amount.LessThan(threshold) {
+			c.Next()
+			return
+		}
+
+		principal, ok := h.principal(c)
+		if !ok {
+			return
+		}
+
+		code := c.GetHeader(TOTPHeader)
+		if code == "" {
+			totp, err := h.storage.GetTOTP(c, principal.UserID)
+			switch {
+			case errors.Is(err, storages.ErrMFANotEnrolled) || (err == nil && !totp.Confirmed):
+				c.Next()
+			case err != nil:
+				h.log(c).Error("Could not get totp", zap.Int("user_id", principal.UserID), zap.Error(err))
+				problem.Respond(c, problem.CodeInternal, "failed to verify one-time code")
+			default:
+				problem.Respond(c, problem.CodeMFARequired, "one-time code is required for this amount")
+			}
+			return
+		}
+
+		subject := strconv.Itoa(principal.UserID)
+		wait, _, err := h.stepUpGuard.Attempt(c, subject)
+		if err != nil {
+			h.log(c).Error("Could not record step-up attempt", zap.Int("user_id", principal.UserID), zap.Error(err))
+			problem.Respond(c, problem.CodeInternal, "failed to verify one-time code")
+			return
+		}
+		if wait > 0 {
+			h.log(c).Warn("Step-up rejected: too many wrong one-time codes", zap.Int("user_id", principal.UserID))
+			ratelimit.SetRetryAfter(c, wait)
+			problem.Respond(c, problem.CodeAccountLocked, "too many wrong one-time codes, retry later")
+			return
+		}
+
+		err = h.verifyTOTP(c, principal.UserID, code)
+		switch {
+		case err == nil, errors.Is(err, storages.ErrMFANotEnrolled):
+			if err := h.stepUpGuard.Success(c, subject); err != nil {
+				h.log(c).Warn("Could not reset step-up failures", zap.Int("user_id", principal.UserID), zap.Error(err))
+			}
+			c.Next()
+		case errors.Is(err, storages.ErrTOTPInvalid):
+			h.log(c).Info("Step-up failed: wrong one-time code", zap.Int("user_id", principal.UserID))
+			problem.Respond(c, problem.CodeMFARequired, storages.ErrTOTPInvalid.Error())
+		default:
+			h.log(c).Error("Could not verify one-time code", zap.Int("user_id", principal.UserID), zap.Error(err))
+			problem.Respond(c, problem.CodeInternal, "failed to verify one-time code")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+)
+
+// CreateQuote godoc
+//
+//	@Summary      Exchange quote
+//	@Description  Фиксирует курс и суммы обмена на время QUOTE_TTL. Обменять по котировке можно один раз, передав quote_id в /api/v1/exchange
+//	@Tags         exchange
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param		  amount body storages.Exchanger true "Exchange query in json format"
+//	@Accept       json
+//	@Produce      json
+//	@Success      201 {object} storages.Quote
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Failure      503 {object} problem.Problem
+//	@Router       /api/v1/exchange/quotes [post]
+func (h *Handler) CreateQuote(c *gin.Context) {
+	var ex storages.Exchanger
+
+	if !h.bindJSON(c, &ex) {
+		return
+	}
+
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	rate, err := h.pairRate(c.Request.Context(), ex.FromCurrency, ex.ToCurrency)
+	if err != nil {
+		respondRateError(c, err)
+		return
+	}
+
+	quote, err := h.storage.CreateQuote(c, principal.WalletUUID, ex, rate, h.quoteTTL)
+	if err != nil {
+		h.log(c).Error("Could not create quote", zap.String("from", ex.FromCurrency), zap.String("to", ex.ToCurrency), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, quote)
+}
+
+// exchangeByQuote обмен по ранее выданной котировке
+func (h *Handler) exchangeByQuote(c *gin.Context, walletUUID, quoteID string) {
+	if _, err := uuid.Parse(quoteID); err != nil {
+		problem.Respond(c, problem.CodeBadRequest, "invalid quote_id")
+		return
+	}
+
+	wallet, quote, err := h.storage.ExchangeByQuote(c, walletUUID, quoteID)
+	if err != nil {
+		h.log(c).Error("Could not exchange by quote", zap.String("quote_id", quoteID), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	h.log(c).Debug("Updated wallet balance", zap.Any("balance", wallet.Balance))
+	h.exchangeMetrics(quote.FromCurrency, quote.FromAmount, quote.ToCurrency, quote.ToAmount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Exchange completed successfully",
+		"quote_id":         quote.ID,
+		"rate":             quote.Rate,
+		"exchanged_amount": quote.ToAmount,
+		"new_balance":      wallet.Balance,
+	})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	pb "github.com/galkin09/proto-exchange/exchange"
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gw-currency-wallet/internal/grpc/exchanger"
+	"gw-currency-wallet/internal/money"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+const ratesCacheKey = "rates"
+
+var (
+	errRateUnavailable = errors.New("exchange rate unavailable")
+	// errEmptyRateResponse обменник ответил без ошибки, но и без данных
+	errEmptyRateResponse = errors.New("exchanger returned an empty response")
+)
+
+// RatesResponse курсы валют и момент, на который они получены.
+// Stale == true, если обменник недоступен и отданы последние сохранённые курсы
+type RatesResponse struct {
+	Rates storages.Rates `json:"rates" swaggertype:"object,string" example:"RUB:95.5,EUR:0.92"`
+	AsOf  time.Time      `json:"as_of"`
+	Stale bool           `json:"stale"`
+}
+
+// cachedRates последние полученные от обменника курсы
+type cachedRates struct {
+	rates storages.Rates
+	asOf  time.Time
+}
+
+// cachedRate последний полученный курс пары валют
+type cachedRate struct {
+	rate decimal.Decimal
+	asOf time.Time
+}
+
+func pairCacheKey(from, to string) string {
+	return "rate:" + from + ":" + to
+}
+
+// rates запрашивает курсы у обменника, а при его недоступности возвращает последние сохранённые.
+// В ответ попадают только валюты из справочника.
+// Курсы хранятся в кэше без срока жизни, их возраст определяется по asOf
+func (h *Handler) rates(ctx context.Context) (RatesResponse, error) {
+	eResp, err := h.exch.GetExchangeRates(ctx, &pb.Empty{})
+	if err == nil && eResp == nil {
+		err = errEmptyRateResponse
+	}
+	if err == nil {
+		var currencies []storages.Currency
+		currencies, err = h.storage.ListCurrencies(ctx)
+		if err == nil {
+			return h.cacheRates(currencies, eResp.GetRates()), nil
+		}
+	}
+
+	h.log(ctx).Error("Could not get exchange rates", zap.Error(err))
+
+	cached, ok := h.cache.Get(ratesCacheKey)
+	if !ok {
+		return RatesResponse{}, errRateUnavailable
+	}
+
+	last := cached.(cachedRates)
+	h.log(ctx).Warn("Serving cached exchange rates", zap.Time("as_of", last.asOf))
+
+	return RatesResponse{Rates: last.rates, AsOf: last.asOf, Stale: true}, nil
+}
+
+// cacheRates отбирает курсы валют справочника и сохраняет их как последние полученные
+func (h *Handler) cacheRates(currencies []storages.Currency, mapRates map[string]float32) RatesResponse {
+	rates := make(storages.Rates, len(currencies))
+	for _, c := range currencies {
+		if rate, ok := mapRates[c.Code]; ok {
+			rates[c.Code] = money.RateFromFloat32(rate)
+		}
+	}
+
+	asOf := time.Now()
+	h.cache.Set(ratesCacheKey, cachedRates{rates: rates, asOf: asOf}, cache.NoExpiration)
+
+	return RatesResponse{Rates: rates, AsOf: asOf}
+}
+
+// pairRate курс обмена from -> to. При недоступности обменника используется сохранённый курс,
+// если он не старше maxRateAge, иначе возвращается errRateUnavailable.
+// Отказ обменника по существу запроса (неизвестная пара и т.п.) возвращается как есть, см. respondRateError
+func (h *Handler) pairRate(ctx context.Context, from, to string) (decimal.Decimal, error) {
+	key := pairCacheKey(from, to)
+
+	resp, err := h.exch.GetExchangeRateForCurrency(ctx, &pb.CurrencyRequest{
+		FromCurrency: from,
+		ToCurrency:   to,
+	})
+	if err == nil && resp == nil {
+		err = errEmptyRateResponse
+	}
+	if err == nil {
+		rate := money.RateFromFloat32(resp.Rate)
+		h.cache.Set(key, cachedRate{rate: rate, asOf: time.Now()}, cache.NoExpiration)
+		return rate, nil
+	}
+
+	if !exchangerUnavailable(err) {
+		h.log(ctx).Warn("Exchanger rejected rate request", zap.String("from", from), zap.String("to", to), zap.Error(err))
+		return decimal.Zero, err
+	}
+
+	h.log(ctx).Error("Could not get exchange rate", zap.String("from", from), zap.String("to", to), zap.Error(err))
+
+	cached, ok := h.cache.Get(key)
+	if !ok {
+		return decimal.Zero, errRateUnavailable
+	}
+
+	last := cached.(cachedRate)
+	age := time.Since(last.asOf)
+	if age > h.maxRateAge {
+		h.log(ctx).Warn("Cached exchange rate is too old", zap.String("from", from), zap.String("to", to), zap.Duration("age", age))
+		return decimal.Zero, errRateUnavailable
+	}
+
+	h.log(ctx).Warn("Using cached exchange rate", zap.String("from", from), zap.String("to", to), zap.Duration("age", age))
+	return last.rate, nil
+}
+
+// exchangerUnavailable ошибка говорит о недоступности обменника, а не об ошибке в запросе:
+// только тогда можно подставить сохранённый курс
+func exchangerUnavailable(err error) bool {
+	if errors.Is(err, exchanger.ErrCircuitOpen) || errors.Is(err, errEmptyRateResponse) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// respondRateError отвечает на ошибку pairRate: ошибки запроса, которые вернул обменник, отдаются клиенту
+// как 400 и 404, всё остальное - 503 rate_unavailable
+func respondRateError(c *gin.Context, err error) {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		problem.Respond(c, problem.CodeBadRequest, "exchanger rejected the currency pair")
+	case codes.NotFound:
+		problem.Respond(c, problem.CodeNotFound, "exchange rate for the currency pair not found")
+	default:
+		problem.Respond(c, problem.CodeRateUnavailable, errRateUnavailable.Error())
+	}
+}
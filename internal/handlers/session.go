@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+	"time"
+)
+
+// TokenResponse пара токенов сессии
+type TokenResponse struct {
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// RefreshRequest тело запроса обновления токенов
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// issueTokens готовит новый refresh-токен, идентификатор и срок access-токена.
+// Сам access-токен подписывается h.signTokens после того, как refresh-токен сохранён в БД
+func (h *Handler) issueTokens() (refreshToken string, refresh storages.RefreshToken, err error) {
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return "", storages.RefreshToken{}, err
+	}
+
+	now := time.Now()
+	return refreshToken, storages.RefreshToken{
+		Hash:            hash,
+		ExpiresAt:       now.Add(h.refreshTTL),
+		AccessJTI:       uuid.NewString(),
+		AccessExpiresAt: now.Add(h.accessTTL),
+	}, nil
+}
+
+func (h *Handler) signTokens(user storages.User, sessionID, refreshToken string, refresh storages.RefreshToken) (TokenResponse, error) {
+	token, err := h.tokens.GenerateToken(user, sessionID, refresh.AccessJTI, refresh.AccessExpiresAt)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{Token: token, ExpiresAt: refresh.AccessExpiresAt, RefreshToken: refreshToken}, nil
+}
+
+// startSession начинает новую сессию пользователя и выдаёт её первую пару токенов
+func (h *Handler) startSession(c *gin.Context, user storages.User) (TokenResponse, error) {
+	refreshToken, refresh, err := h.issueTokens()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	session := storages.Session{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+	if err := h.storage.CreateSession(c, session, refresh); err != nil {
+		return TokenResponse{}, err
+	}
+
+	return h.signTokens(user, session.ID, refreshToken, refresh)
+}
+
+// RefreshToken godoc
+//
+//	@Summary      Refresh tokens
+//	@Description  Обменивает refresh-токен на новую пару токенов. Refresh-токен одноразовый: повторное предъявление
+//	@Description  уже использованного токена отзывает всю сессию
+//	@Tags         users
+//	@Accept       json
+//	@Produce      json
+//	@Param        input body RefreshRequest true "Refresh-токен"
+//	@Success      200 {object} TokenResponse
+//	@Failure      400 {object} problem.Problem
+//	@Failure      401 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Router       /api/v1/token/refresh [post]
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	refreshToken, refresh, err := h.issueTokens()
+	if err != nil {
+		h.log(c).Error("Could not issue tokens", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to refresh token")
+		return
+	}
+
+	user, session, err := h.storage.RotateRefreshToken(c, auth.HashRefreshToken(req.RefreshToken), refresh)
+	switch {
+	case errors.Is(err, storages.ErrRefreshTokenReused):
+		h.log(c).Warn("Refresh token reuse detected, session revoked", zap.Error(err))
+		problem.Respond(c, problem.CodeUnauthorized, "invalid refresh token")
+		return
+	case errors.Is(err, storages.ErrRefreshTokenInvalid):
+		problem.Respond(c, problem.CodeUnauthorized, "invalid refresh token")
+		return
+	case err != nil:
+		h.log(c).Error("Could not rotate refresh token", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to refresh token")
+		return
+	}
+
+	tokens, err := h.signTokens(user, session.ID, refreshToken, refresh)
+	if err != nil {
+		h.log(c).Error("Could not sign token", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to refresh token")
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+//
+//	@Summary      Logout
+//	@Description  Завершает текущую сессию: отзывает её refresh-токены и выданные в ней access-токены
+//	@Tags         users
+//	@Param 		  Authorization header string true "JWT token"
+//	@Produce      json
+//	@Success      200
+//	@Failure      401 {object} problem.Problem
+//	@Router       /api/v1/logout [post]
+func (h *Handler) Logout(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	h.revokeSession(c, principal.SessionID)
+}
+
+// ListSessions godoc
+//
+//	@Summary      Active sessions
+//	@Description  Действующие сессии пользователя. У сессии текущего токена current=true
+//	@Tags         users
+//	@Param 		  Authorization header string true "JWT token"
+//	@Produce      json
+//	@Success      200 {array} storages.Session
+//	@Failure      401 {object} problem.Problem
+//	@Router       /api/v1/sessions [get]
+func (h *Handler) ListSessions(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.storage.ListSessions(c, principal.UserID)
+	if err != nil {
+		h.log(c).Error("Could not list sessions", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to list sessions")
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == principal.SessionID
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession godoc
+//
+//	@Summary      Revoke session
+//	@Description  Завершает сессию пользователя по id, например, на потерянном устройстве
+//	@Tags         users
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        id path string true "ID сессии"
+//	@Produce      json
+//	@Success      200
+//	@Failure      401 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Router       /api/v1/sessions/{id} [delete]
+func (h *Handler) RevokeSession(c *gin.Context) {
+	h.revokeSession(c, c.Param("id"))
+}
+
+func (h *Handler) revokeSession(c *gin.Context, sessionID string) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	if _, err := uuid.Parse(sessionID); err != nil {
+		problem.Respond(c, problem.CodeNotFound, storages.ErrSessionNotFound.Error())
+		return
+	}
+
+	err := h.storage.RevokeSession(c, principal.UserID, sessionID)
+	if errors.Is(err, storages.ErrSessionNotFound) {
+		problem.Error(c, err)
+		return
+	}
+	if err != nil {
+		h.log(c).Error("Could not revoke session", zap.String("session_id", sessionID), zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to revoke session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
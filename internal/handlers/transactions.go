@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultTransactionsLimit = 20
+	maxTransactionsLimit     = 100
+)
+
+var transactionTypes = map[string]bool{
+	storages.TransactionDeposit:     true,
+	storages.TransactionWithdraw:    true,
+	storages.TransactionExchange:    true,
+	storages.TransactionTransferOut: true,
+	storages.TransactionTransferIn:  true,
+	storages.TransactionAdjustment:  true,
+}
+
+// TransactionsPage страница истории операций
+type TransactionsPage struct {
+	Transactions []storages.Transaction `json:"transactions"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
+}
+
+// GetTransactions godoc
+//
+//	@Summary      Transaction history
+//	@Description  История операций кошелька от новых к старым. Для следующей страницы передайте next_cursor в параметре cursor
+//	@Tags         wallets
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param        type query string false "deposit, withdraw, exchange, transfer_out, transfer_in или adjustment"
+//	@Param        currency query string false "Код валюты (списания или зачисления)"
+//	@Param        from query string false "Начало периода, RFC 3339"
+//	@Param        to query string false "Конец периода (не включая), RFC 3339"
+//	@Param        cursor query string false "Курсор из next_cursor"
+//	@Param        limit query int false "Размер страницы, по умолчанию 20, максимум 100"
+//	@Produce      json
+//	@Success      200 {object} TransactionsPage
+//	@Failure      400 {object} problem.Problem
+//	@Router       /api/v1/transactions [get]
+func (h *Handler) GetTransactions(c *gin.Context) {
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		problem.Respond(c, problem.CodeBadRequest, err.Error())
+		return
+	}
+
+	// Запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+
+	transactions, err := h.storage.ListTransactions(c, principal.WalletUUID, filter)
+	if err != nil {
+		h.log(c).Error("Could not list transactions", zap.Error(err))
+		problem.Respond(c, problem.CodeInternal, "failed to list transactions")
+		return
+	}
+
+	page := TransactionsPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		page.NextCursor = encodeCursor(page.Transactions[limit-1].ID)
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func parseTransactionFilter(c *gin.Context) (storages.TransactionFilter, error) {
+	filter := storages.TransactionFilter{
+		Type:     c.Query("type"),
+		Currency: c.Query("currency"),
+		Limit:    defaultTransactionsLimit,
+	}
+
+	if filter.Type != "" && !transactionTypes[filter.Type] {
+		return filter, errInvalidParam("type")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTransactionsLimit {
+			return filter, errInvalidParam("limit")
+		}
+		filter.Limit = limit
+	}
+
+	if v := c.Query("from"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, errInvalidParam("from")
+		}
+		filter.Since = since
+	}
+
+	if v := c.Query("to"); v != "" {
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, errInvalidParam("to")
+		}
+		filter.Until = until
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		id, err := decodeCursor(v)
+		if err != nil {
+			return filter, errInvalidParam("cursor")
+		}
+		filter.AfterID = id
+	}
+
+	return filter, nil
+}
+
+// encodeCursor курсор непрозрачен для клиента, внутри - id последней записи страницы
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errInvalidParam("cursor")
+	}
+	return id, nil
+}
+
+type errInvalidParam string
+
+func (e errInvalidParam) Error() string {
+	return "invalid query parameter: " + string(e)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/metrics"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+)
+
+// maxMemoLen наибольшая длина комментария к переводу и причины действия администратора
+const maxMemoLen = 255
+
+// Transfer moves funds to another user's wallet
+//
+//	@Summary      Transfer to another user
+//	@Description  Перевод средств другому пользователю. Получатель задаётся ровно одним из полей to_username, to_email, to_wallet_uuid
+//	@Tags         wallets
+//	@Param 		  Authorization header string true "JWT token"
+//	@Param 		  Idempotency-Key header string false "Ключ идемпотентности: повтор с тем же ключом вернёт первый ответ"
+//	@Param 		  X-TOTP-Code header string false "Свежий код TOTP, обязателен для сумм от порога MFA_STEP_UP_THRESHOLDS при включённом втором факторе"
+//	@Param		  transfer body storages.Transfer true "Transfer query in json format"
+//	@Accept       json
+//	@Produce      json
+//	@Success      200
+//	@Failure      400 {object} problem.Problem
+//	@Failure      403 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
+//	@Failure      409 {object} problem.Problem
+//	@Failure      413 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
+//	@Failure      429 {object} problem.Problem
+//	@Router       /api/v1/transfers [post]
+func (h *Handler) Transfer(c *gin.Context) {
+	var tq storages.Transfer
+
+	if !h.bindJSON(c, &tq) {
+		return
+	}
+
+	principal, ok := h.principal(c)
+	if !ok {
+		return
+	}
+
+	wallet, err := h.storage.Transfer(c, principal.WalletUUID, tq)
+	if err != nil {
+		h.log(c).Error("Could not transfer", zap.String("currency", tq.Currency), zap.Error(err))
+		problem.Error(c, err)
+		return
+	}
+
+	h.metrics.MoneyOperation(metrics.OpTransfer, tq.Currency, tq.Amount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transfer completed successfully",
+		"new_balance": wallet.Balance,
+	})
+}
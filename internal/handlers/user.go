@@ -1,120 +1,224 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/ratelimit"
 	"gw-currency-wallet/internal/storages"
 	"net/http"
-	"time"
 )
 
+// RegisterRequest данные нового пользователя
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required,username" example:"alice"`
+	Email    string `json:"email" binding:"required,email,max=254" example:"alice@example.com"`
+	Password string `json:"password" binding:"required,password"`
+}
+
 // RegisterUser adds new user account
 //
 //	@Summary      Register user
-//	@Description  Регистрация нового пользователя
+//	@Description  Регистрация нового пользователя. На email отправляется ссылка для подтверждения адреса,
+//	@Description  до подтверждения доступны только операции чтения.
+//	@Description  Имя - 3-32 символа из латинских букв, цифр, '.', '_' и '-'; пароль - 8-72 символа, буквы и цифры
 //	@Tags         users
 //	@Accept       json
 //	@Produce      json
-//	@Param input body storages.User true "user info"
+//	@Param input body RegisterRequest true "user info"
 //	@Success      201
-//	@Failure      400
+//	@Failure      400 {object} problem.Problem
+//	@Failure      422 {object} problem.Problem
 //	@Router       /api/v1/register [post]
 func (h *Handler) RegisterUser(ctx *gin.Context) {
-	var user storages.User
+	var req RegisterRequest
 
-	if err := ctx.ShouldBindJSON(&user); err != nil {
-		h.logger.Error("Error binding JSON", zap.Error(err))
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !h.bindJSON(ctx, &req) {
 		return
 	}
 
-	if user == (storages.User{}) {
-		h.logger.Error("User is nil", zap.Any("user", user))
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "User is nil"})
+	user := storages.User{Username: req.Username, Email: req.Email, Password: req.Password}
+
+	hash, err := h.hasher.Hash(user.Password)
+	if err != nil {
+		h.log(ctx).Error("Could not hash password", zap.Error(err))
+		problem.Respond(ctx, problem.CodeBadRequest, "invalid password")
 		return
 	}
+	user.PasswordHash = hash
 
-	if err := h.storage.RegisterUser(ctx, user); err != nil {
-		h.logger.Error("Username or email already exists", zap.Error(err))
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	user.ID, err = h.storage.RegisterUser(ctx, user)
+	if errors.Is(err, storages.ErrUserExists) {
+		h.log(ctx).Info("Username or email already exists", zap.String("username", user.Username))
+		problem.Error(ctx, err)
+		return
+	}
+	if err != nil {
+		h.log(ctx).Error("Could not register user", zap.Error(err))
+		problem.Error(ctx, err)
 		return
 	}
 
-	h.logger.Info("Successfully registered user", zap.Any("user", user))
-	ctx.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
+	h.log(ctx).Info("Successfully registered user", zap.Int("user_id", user.ID), zap.String("username", user.Username))
+
+	// Аккаунт уже создан: если письмо не ушло, его можно запросить повторно через /api/v1/email/verify/resend
+	if err := h.sendAccountMail(ctx, user, storages.TokenEmailVerification); err != nil {
+		h.log(ctx).Error("Could not send verification email", zap.Int("user_id", user.ID), zap.Error(err))
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"message": "User registered successfully, check your email to verify the address"})
 }
 
 // LoginUser authorizes  adds new user account
 //
 //		@Summary      Authorize  user
-//		@Description  Авторизация пользователя
+//		@Description  Авторизация пользователя. Возвращает access-токен и refresh-токен новой сессии.
+//		@Description  Если у пользователя включён TOTP, возвращает mfa_required и mfa_token для /api/v1/login/mfa.
+//		@Description  После нескольких неудачных попыток следующая откладывается (429 rate_limited с Retry-After),
+//		@Description  после LOGIN_LOCKOUT_THRESHOLD неудач вход под этим именем блокируется (429 account_locked)
 //		@Tags         users
 //		@Accept       json
 //		@Produce      json
 //	    @Param input body storages.User true "Данные пользователя"
-//		@Success      200
-//		@Failure      400
+//		@Success      200 {object} TokenResponse
+//		@Failure      400 {object} problem.Problem
+//		@Failure      401 {object} problem.Problem
+//		@Failure      429 {object} problem.Problem
 //		@Router       /api/v1/login [post]
 func (h *Handler) LoginUser(ctx *gin.Context) {
 	var user storages.User
 
-	if err := ctx.ShouldBindJSON(&user); err != nil {
-		h.logger.Error("Error binding JSON", zap.Error(err))
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !h.bindJSON(ctx, &user) {
+		return
+	}
+
+	if !h.loginAllowed(ctx, user.Username) {
+		return
+	}
+
+	stored, err := h.storage.GetUserByUsername(ctx, user.Username)
+	if errors.Is(err, storages.ErrUserNotFound) {
+		// Проверяем пароль вхолостую, чтобы по времени ответа нельзя было понять, существует ли пользователь
+		h.hasher.VerifyDummy(user.Password)
+		h.log(ctx).Info("Login failed: unknown user", zap.String("username", user.Username))
+		problem.Respond(ctx, problem.CodeUnauthorized, "invalid username or password")
+		return
+	}
+	if err != nil {
+		h.log(ctx).Error("Could not get user", zap.Error(err))
+		problem.Respond(ctx, problem.CodeInternal, "failed to login")
+		return
+	}
+
+	match, needsRehash, err := h.hasher.Verify(user.Password, stored.PasswordHash)
+	if err != nil {
+		h.log(ctx).Error("Could not verify password", zap.String("username", stored.Username), zap.Error(err))
+		problem.Respond(ctx, problem.CodeInternal, "failed to login")
+		return
+	}
+	if !match {
+		h.log(ctx).Info("Login failed: wrong password", zap.String("username", stored.Username))
+		problem.Respond(ctx, problem.CodeUnauthorized, "invalid username or password")
+		return
+	}
+
+	if err := h.loginGuard.Success(ctx, user.Username); err != nil {
+		h.log(ctx).Warn("Could not reset login failures", zap.String("username", stored.Username), zap.Error(err))
+	}
+
+	if needsRehash {
+		h.rehashPassword(ctx, stored, user.Password)
+	}
+
+	totp, err := h.storage.GetTOTP(ctx, stored.ID)
+	if err != nil && !errors.Is(err, storages.ErrMFANotEnrolled) {
+		h.log(ctx).Error("Could not get totp", zap.Int("user_id", stored.ID), zap.Error(err))
+		problem.Respond(ctx, problem.CodeInternal, "failed to login")
+		return
+	}
+	if err == nil && totp.Confirmed {
+		h.startMFAChallenge(ctx, stored)
+		return
+	}
+
+	tokens, err := h.startSession(ctx, stored)
+	if err != nil {
+		h.log(ctx).Error("login Error", zap.Error(err))
+		problem.Respond(ctx, problem.CodeInternal, "failed to login")
 		return
 	}
 
-	jwtToken, err := auth.GenerateToken(user, 10*time.Minute)
+	h.log(ctx).Info("Successfully logged in", zap.Int("user_id", stored.ID))
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// loginAllowed учитывает попытку входа под именем username до проверки пароля и проверяет, не отложена ли она
+// после прошлых неудач. Если отложена, отвечает 429 с Retry-After. Сбой хранилища попыток вход не останавливает
+func (h *Handler) loginAllowed(ctx *gin.Context, username string) bool {
+	wait, locked, err := h.loginGuard.Attempt(ctx, username)
+	if err != nil {
+		h.log(ctx).Error("Could not record login attempt", zap.Error(err))
+		return true
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	ratelimit.SetRetryAfter(ctx, wait)
+	if locked {
+		h.log(ctx).Warn("Login rejected: account locked", zap.String("username", username))
+		problem.Respond(ctx, problem.CodeAccountLocked, "too many failed login attempts, account is temporarily locked")
+		return false
+	}
+	h.log(ctx).Info("Login rejected: attempt delayed", zap.String("username", username), zap.Duration("wait", wait))
+	problem.Respond(ctx, problem.CodeRateLimited, "too many failed login attempts, retry later")
+	return false
+}
+
+// rehashPassword пересчитывает хеш пароля по текущим параметрам. Ошибка не мешает входу
+func (h *Handler) rehashPassword(ctx *gin.Context, user storages.User, password string) {
+	hash, err := h.hasher.Hash(password)
 	if err != nil {
-		h.logger.Error("login Error", zap.Error(err))
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.log(ctx).Warn("Could not rehash password", zap.String("username", user.Username), zap.Error(err))
+		return
+	}
+
+	if err := h.storage.UpdateUserPassword(ctx, user.ID, hash); err != nil {
+		h.log(ctx).Warn("Could not store rehashed password", zap.String("username", user.Username), zap.Error(err))
 		return
 	}
 
-	h.logger.Info("Successfully logged in", zap.Any("jwtToken", jwtToken))
-	ctx.JSON(http.StatusOK, gin.H{"token": jwtToken})
+	h.log(ctx).Info("Password rehashed", zap.String("username", user.Username))
 }
 
 // GetBalance godoc
 //
 //	@Summary      Shows wallet balance
-//	@Description  Показывает баланс пользователя на счёте по юзернейму
+//	@Description  Показывает баланс кошелька пользователя из access-токена
 //	@Tags         users, wallets
 //	@Param 		  Authorization header string true "JWT token"
 //	@Accept       json
 //	@Produce      json
 //	@Success      200
-//	@Failure      400
+//	@Failure      401 {object} problem.Problem
+//	@Failure      404 {object} problem.Problem
 //	@Router       /api/v1/balance [get]
 func (h *Handler) GetBalance(ctx *gin.Context) {
-	username, exists := ctx.Get("username")
-	if !exists {
-		h.logger.Error("Username not found in context")
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
-		return
-	}
-
-	usernameStr, ok := username.(string)
+	principal, ok := h.principal(ctx)
 	if !ok {
-		h.logger.Error("Invalid username format in context")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "invalid username format"})
 		return
 	}
 
-	user := storages.User{
-		Username: usernameStr,
-	}
-
-	h.logger.Info("Getting balance for user", zap.String("username", user.Username))
+	h.log(ctx).Info("Getting balance for user", zap.Int("user_id", principal.UserID))
 
-	balance, err := h.storage.GetBalance(ctx, user)
+	wallet, err := h.storage.GetWallet(ctx, principal.WalletUUID)
 	if err != nil {
-		h.logger.Error("GetBalance Error", zap.String("username", user.Username), zap.Error(err))
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		h.log(ctx).Error("GetBalance Error", zap.Int("user_id", principal.UserID), zap.Error(err))
+		problem.Error(ctx, err)
 		return
 	}
 
-	h.logger.Info("Successfully got balance", zap.Any("balance", balance))
-	ctx.JSON(http.StatusOK, gin.H{"balance": balance})
+	h.log(ctx).Info("Successfully got balance", zap.Any("balance", wallet))
+	ctx.JSON(http.StatusOK, gin.H{"balance": wallet})
 }
@@ -0,0 +1,142 @@
+// Package health ручки /healthz и /readyz. Живость означает лишь, что процесс отвечает,
+// готовность - что зависимости доступны и экземпляр не останавливается.
+package health
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Статусы проверок
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check проверка одной зависимости. Ошибка означает, что зависимость недоступна
+type Check func(ctx context.Context) error
+
+// CheckResult результат проверки зависимости
+type CheckResult struct {
+	Status    string  `json:"status" example:"ok"`
+	LatencyMS float64 `json:"latency_ms" example:"1.25"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report ответ /healthz и /readyz
+type Report struct {
+	Status string                 `json:"status" example:"ok"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker набор проверок готовности
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Add добавляет проверку зависимости name
+func (h *Checker) Add(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Shutdown переводит /readyz в 503: новые запросы должны уйти на другие экземпляры до остановки сервера
+func (h *Checker) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// Liveness godoc
+//
+//	@Summary      Liveness
+//	@Description  Процесс запущен и отвечает. Зависимости не проверяются
+//	@Tags         health
+//	@Produce      json
+//	@Success      200 {object} health.Report
+//	@Router       /healthz [get]
+func (h *Checker) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readiness godoc
+//
+//	@Summary      Readiness
+//	@Description  Проверяет зависимости: PostgreSQL, соединение с обменником, версию миграций. Для каждой возвращает статус и задержку.
+//	@Description  503, если хотя бы одна зависимость недоступна или сервис останавливается
+//	@Tags         health
+//	@Produce      json
+//	@Success      200 {object} health.Report
+//	@Failure      503 {object} health.Report
+//	@Router       /readyz [get]
+func (h *Checker) Readiness(c *gin.Context) {
+	if h.shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, Report{Status: StatusFail, Checks: map[string]CheckResult{
+			"shutdown": {Status: StatusFail, Error: "server is shutting down"},
+		}})
+		return
+	}
+
+	report := h.run(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// run выполняет проверки параллельно, каждую со своим таймаутом
+func (h *Checker) run(ctx context.Context) Report {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			res := CheckResult{Status: StatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
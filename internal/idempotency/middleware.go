@@ -0,0 +1,145 @@
+// Package idempotency реализует обработку заголовка Idempotency-Key: повтор запроса
+// с тем же ключом не выполняет операцию ещё раз, а возвращает сохранённый ответ.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/requestbody"
+	"gw-currency-wallet/internal/storages"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Header заголовок с ключом идемпотентности
+	Header = "Idempotency-Key"
+	// ReplayedHeader выставляется в ответах, возвращённых из сохранённой записи
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLen = 255
+)
+
+// Store хранилище ключей идемпотентности
+type Store interface {
+	ReserveIdempotencyKey(ctx context.Context, owner, key, requestHash string, ttl time.Duration) (storages.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, owner, key string, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, owner, key string) error
+}
+
+// Middleware должен стоять после auth.Auth(): ключи хранятся отдельно для каждого пользователя (по id из токена).
+// Запросы без заголовка обрабатываются как обычно
+func Middleware(store Store, ttl time.Duration, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxKeyLen {
+			problem.Respond(c, problem.CodeBadRequest, "idempotency key is too long")
+			return
+		}
+
+		principal, ok := auth.PrincipalFrom(c)
+		if !ok {
+			problem.Respond(c, problem.CodeUnauthorized, "user not authenticated")
+			return
+		}
+		owner := strconv.Itoa(principal.UserID)
+
+		body, ok := requestbody.Read(c)
+		if !ok {
+			return
+		}
+
+		hash := requestHash(c.Request.Method, c.FullPath(), body)
+
+		rec, created, err := store.ReserveIdempotencyKey(c, owner, key, hash, ttl)
+		if err != nil {
+			logging.FromContext(c, logger).Error("Could not reserve idempotency key", zap.Error(err))
+			problem.Respond(c, problem.CodeInternal, "failed to process idempotency key")
+			return
+		}
+
+		if !created {
+			switch {
+			case rec.RequestHash != hash:
+				problem.Respond(c, problem.CodeIdempotencyMismatch, "idempotency key was already used with a different request")
+			case !rec.Completed:
+				problem.Respond(c, problem.CodeConflict, "request with this idempotency key is in progress")
+			default:
+				c.Header(ReplayedHeader, "true")
+				c.Data(rec.StatusCode, rec.ContentType, rec.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		// Контекст без отмены: ответ уже сформирован и должен быть сохранён, даже если клиент отключился
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		completed := false
+		defer func() {
+			// Внутренняя ошибка или паника - операция не выполнена, разрешаем повторить запрос с тем же ключом
+			if !completed {
+				if err := store.ReleaseIdempotencyKey(ctx, owner, key); err != nil {
+					logging.FromContext(ctx, logger).Error("Could not release idempotency key", zap.Error(err))
+				}
+			}
+		}()
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		// Операция выполнена: даже если ответ не сохранится, ключ не освобождаем,
+		// иначе повтор проведёт её второй раз
+		completed = true
+
+		if err := store.CompleteIdempotencyKey(ctx, owner, key, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			logging.FromContext(ctx, logger).Error("Could not store idempotent response", zap.Error(err))
+		}
+	}
+}
+
+// requestHash отпечаток запроса: повтор ключа допустим только для того же метода, маршрута и тела
+func requestHash(method, route string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(route))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyRecorder копирует тело ответа, чтобы сохранить его для повторов
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
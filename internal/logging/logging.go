@@ -0,0 +1,49 @@
+// Package logging структурированные логи сервиса: JSON-логгер с маскированием секретов и персональных данных,
+// логгер запроса в контексте (request ID, маршрут, пользователь, трасса) и журнал HTTP-запросов.
+package logging
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"time"
+)
+
+type ctxKey struct{}
+
+// New JSON-логгер в stderr. Каждая запись проходит через маскирование (см. Redact)
+func New() *zap.Logger {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.TimeKey = "time"
+	cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	core := zapcore.NewCore(newRedactingEncoder(zapcore.NewJSONEncoder(cfg)), zapcore.Lock(os.Stderr), zap.InfoLevel)
+	// Как у zap.NewProduction: не больше 100 одинаковых записей в секунду, дальше каждая сотая
+	core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
+}
+
+// NewContext возвращает копию ctx с логгером запроса
+func NewContext(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext логгер запроса из ctx, вне запроса - fallback
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// With добавляет поля в логгер запроса: они попадут во все следующие записи запроса и в журнал запросов.
+// Без логгера в контексте ничего не делает
+func With(c *gin.Context, fields ...zap.Field) {
+	ctx := c.Request.Context()
+	if logger, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		c.Request = c.Request.WithContext(NewContext(ctx, logger.With(fields...)))
+	}
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/requestid"
+	"gw-currency-wallet/internal/tracing"
+	"net/http"
+	"time"
+)
+
+// Middleware кладёт в контекст логгер запроса с request ID, методом, маршрутом и трассой
+// и после ответа пишет запись журнала запросов. Успешные запросы к маршрутам quiet
+// (пробы и сбор метрик) в журнал не пишутся. Должен стоять после requestid.Middleware() и tracing.Middleware()
+func Middleware(base *zap.Logger, quiet ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(quiet))
+	for _, route := range quiet {
+		skip[route] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx := c.Request.Context()
+		route := c.FullPath()
+
+		fields := append([]zap.Field{
+			zap.String("request_id", requestid.FromContext(ctx)),
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+		}, tracing.Fields(ctx)...)
+		c.Request = c.Request.WithContext(NewContext(ctx, base.With(fields...)))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if skip[route] && status < http.StatusBadRequest {
+			return
+		}
+
+		// Берётся логгер из контекста после обработки: в нём уже есть пользователь, если запрос прошёл auth.Auth()
+		logger := FromContext(c.Request.Context(), base)
+		level := zapcore.InfoLevel
+		if status >= http.StatusInternalServerError {
+			level = zapcore.ErrorLevel
+			// Стек middleware журнала ничего не говорит об ошибке, она уже записана обработчиком
+			logger = logger.WithOptions(zap.AddStacktrace(zapcore.FatalLevel))
+		}
+
+		// Строка запроса не пишется: в ней бывают токены из писем
+		logger.Log(level, "HTTP request",
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("bytes", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		)
+	}
+}
+
+// Recovery перехватывает панику обработчика, пишет её в лог запроса со стеком и отвечает 500.
+// Должен стоять после Middleware(), чтобы паника попала в лог с request ID, а журнал запросов увидел статус 500
+func Recovery(base *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// Обрыв соединения клиентом net/http обрабатывает сам
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			// Стек вызова здесь включает кадры паники, логгер добавляет его к записи уровня Error
+			FromContext(c.Request.Context(), base).Error("Panic recovered", zap.Any("panic", rec))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			problem.Respond(c, problem.CodeInternal, "internal server error")
+		}()
+		c.Next()
+	}
+}
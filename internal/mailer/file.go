@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File складывает письма в каталог файлами .eml, их можно открыть любым почтовым клиентом
+type File struct {
+	from string
+	dir  string
+}
+
+func NewFile(from, dir string) (*File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mail directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &File{from: from, dir: dir}, nil
+}
+
+func (m *File) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	data, err := compose(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o640)
+}
+
+// Log пишет письма в лог вместе с текстом. В тексте писем есть одноразовые токены,
+// поэтому драйвер предназначен только для локальной разработки
+type Log struct {
+	from   string
+	logger *zap.Logger
+}
+
+func NewLog(from string, logger *zap.Logger) *Log {
+	return &Log{from: from, logger: logger}
+}
+
+func (m *Log) Send(_ context.Context, msg Message) error {
+	if _, err := compose(m.from, msg, time.Now()); err != nil {
+		return err
+	}
+	m.logger.Info("Mail", zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("body", msg.Body))
+	return nil
+}
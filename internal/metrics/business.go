@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+// businessTimeout ограничение на один пересчёт бизнес-метрик
+const businessTimeout = 30 * time.Second
+
+// BusinessSource источник бизнес-метрик
+type BusinessSource interface {
+	BalanceTotals(ctx context.Context) ([]storages.BalanceTotal, error)
+}
+
+// RunBusiness пересчитывает бизнес-метрики сразу и затем каждые interval, пока не отменён ctx.
+// Сбор метрик только читает последние значения, поэтому частые запросы к /metrics не нагружают БД.
+// При ошибке остаются прежние значения, устаревание видно по last_update_timestamp_seconds
+func (m *Metrics) RunBusiness(ctx context.Context, source BusinessSource, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.refreshBusiness(ctx, source, logger)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Metrics) refreshBusiness(ctx context.Context, source BusinessSource, logger *zap.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, businessTimeout)
+	defer cancel()
+
+	totals, err := source.BalanceTotals(ctx)
+	if err != nil {
+		logger.Warn("Could not refresh business metrics", zap.Error(err))
+		return
+	}
+
+	for _, t := range totals {
+		m.balanceTotal.WithLabelValues(t.Currency).Set(t.Amount.InexactFloat64())
+		m.balanceWallets.WithLabelValues(t.Currency).Set(float64(t.Wallets))
+	}
+	m.businessUpdate.SetToCurrentTime()
+}
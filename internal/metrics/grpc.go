@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// UnaryClientInterceptor учитывает длительность и код ответа каждого gRPC-вызова обменника.
+// Повторы клиента проходят через перехватчик отдельно, вызовы при разомкнутом выключателе до него не доходят
+func (m *Metrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		m.grpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		m.grpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+		return err
+	}
+}
@@ -0,0 +1,158 @@
+// Package metrics метрики Prometheus: HTTP-запросы, операции с деньгами, пул соединений PostgreSQL,
+// вызовы обменника и бизнес-показатели. Все метрики регистрируются в собственном реестре и отдаются ручкой Handler
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shopspring/decimal"
+	"strconv"
+	"time"
+)
+
+const namespace = "wallet"
+
+// Операции с деньгами в метриках. Обмен учитывается двумя записями: списанная валюта и зачисленная
+const (
+	OpDeposit     = "deposit"
+	OpWithdraw    = "withdraw"
+	OpExchangeOut = "exchange_out"
+	OpExchangeIn  = "exchange_in"
+	OpTransfer    = "transfer"
+)
+
+// unmatchedRoute метка маршрута для запросов, не попавших ни в один маршрут: путь запроса в метку не пишется,
+// иначе произвольные URL раздуют число временных рядов
+const unmatchedRoute = "unmatched"
+
+// Metrics реестр и метрики сервиса
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+
+	moneyOperations *prometheus.CounterVec
+	moneyAmount     *prometheus.CounterVec
+
+	grpcDuration *prometheus.HistogramVec
+	grpcRequests *prometheus.CounterVec
+
+	balanceTotal   *prometheus.GaugeVec
+	balanceWallets *prometheus.GaugeVec
+	businessUpdate prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Длительность обработки HTTP-запросов по маршрутам и статусам ответа",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Число HTTP-запросов в обработке",
+		}),
+
+		moneyOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "money",
+			Name:      "operations_total",
+			Help:      "Число успешных операций с деньгами по типам и валютам",
+		}, []string{"operation", "currency"}),
+		moneyAmount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "money",
+			Name:      "amount_total",
+			Help:      "Сумма успешных операций с деньгами по типам и валютам",
+		}, []string{"operation", "currency"}),
+
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "exchanger",
+			Name:      "request_duration_seconds",
+			Help:      "Длительность gRPC-вызовов обменника, каждая попытка учитывается отдельно",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2, 5},
+		}, []string{"method"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exchanger",
+			Name:      "requests_total",
+			Help:      "Число gRPC-вызовов обменника по методам и кодам ответа",
+		}, []string{"method", "code"}),
+
+		balanceTotal: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "business",
+			Name:      "balance_total",
+			Help:      "Сумма балансов всех кошельков по валютам",
+		}, []string{"currency"}),
+		balanceWallets: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "business",
+			Name:      "funded_wallets",
+			Help:      "Число кошельков с ненулевым балансом по валютам",
+		}, []string{"currency"}),
+		businessUpdate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "business",
+			Name:      "last_update_timestamp_seconds",
+			Help:      "Время последнего успешного пересчёта бизнес-метрик",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration, m.httpInFlight,
+		m.moneyOperations, m.moneyAmount,
+		m.grpcDuration, m.grpcRequests,
+		m.balanceTotal, m.balanceWallets, m.businessUpdate,
+	)
+	return m
+}
+
+// Register добавляет в реестр сторонний сборщик, например статистику пула соединений
+func (m *Metrics) Register(c prometheus.Collector) error {
+	return m.registry.Register(c)
+}
+
+// Handler ручка /metrics в формате Prometheus
+func (m *Metrics) Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry}))
+}
+
+// HTTP учитывает длительность и статус каждого запроса. Маршрут берётся шаблоном gin (/api/v1/sessions/:id),
+// а не путём запроса, чтобы число временных рядов не зависело от параметров в URL
+func (m *Metrics) HTTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.httpInFlight.Inc()
+		defer m.httpInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.httpDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// MoneyOperation учитывает успешную операцию с деньгами. Сумма в метрике приблизительная (float64),
+// для сверки денег она не годится - только для графиков
+func (m *Metrics) MoneyOperation(operation, currency string, amount decimal.Decimal) {
+	m.moneyOperations.WithLabelValues(operation, currency).Inc()
+	m.moneyAmount.WithLabelValues(operation, currency).Add(amount.Abs().InexactFloat64())
+}
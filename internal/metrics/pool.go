@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector статистика пула соединений pgxpool. Значения читаются из пула в момент сбора метрик
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	idleConns            *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+	lifetimeDestroyCount *prometheus.Desc
+	idleDestroyCount     *prometheus.Desc
+}
+
+// NewPoolCollector сборщик статистики пула. stat может вернуть nil, пока пул не создан - тогда метрик нет
+func NewPoolCollector(stat func() *pgxpool.Stat) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		stat:                 stat,
+		acquireCount:         desc("acquire_total", "Число успешных получений соединения из пула"),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Суммарное время ожидания соединения из пула"),
+		canceledAcquireCount: desc("canceled_acquire_total", "Число получений соединения, отменённых контекстом"),
+		emptyAcquireCount:    desc("empty_acquire_total", "Число получений соединения, которым пришлось ждать: свободных соединений не было"),
+		acquiredConns:        desc("acquired_connections", "Число соединений, занятых запросами"),
+		constructingConns:    desc("constructing_connections", "Число устанавливаемых соединений"),
+		idleConns:            desc("idle_connections", "Число свободных соединений"),
+		totalConns:           desc("total_connections", "Число соединений в пуле"),
+		maxConns:             desc("max_connections", "Наибольшее число соединений в пуле"),
+		newConnsCount:        desc("new_connections_total", "Число установленных соединений"),
+		lifetimeDestroyCount: desc("max_lifetime_destroy_total", "Число соединений, закрытых по MaxConnLifetime"),
+		idleDestroyCount:     desc("max_idle_destroy_total", "Число соединений, закрытых по MaxConnIdleTime"),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.canceledAcquireCount
+	ch <- c.emptyAcquireCount
+	ch <- c.acquiredConns
+	ch <- c.constructingConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.newConnsCount
+	ch <- c.lifetimeDestroyCount
+	ch <- c.idleDestroyCount
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	if s == nil {
+		return
+	}
+
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+
+	counter(c.acquireCount, float64(s.AcquireCount()))
+	counter(c.acquireDuration, s.AcquireDuration().Seconds())
+	counter(c.canceledAcquireCount, float64(s.CanceledAcquireCount()))
+	counter(c.emptyAcquireCount, float64(s.EmptyAcquireCount()))
+	gauge(c.acquiredConns, float64(s.AcquiredConns()))
+	gauge(c.constructingConns, float64(s.ConstructingConns()))
+	gauge(c.idleConns, float64(s.IdleConns()))
+	gauge(c.totalConns, float64(s.TotalConns()))
+	gauge(c.maxConns, float64(s.MaxConns()))
+	counter(c.newConnsCount, float64(s.NewConnsCount()))
+	counter(c.lifetimeDestroyCount, float64(s.MaxLifetimeDestroyCount()))
+	counter(c.idleDestroyCount, float64(s.MaxIdleDestroyCount()))
+}
@@ -0,0 +1,61 @@
+// Package money содержит правила точной работы с денежными суммами: явные режимы округления
+// и проверку точности. Количество знаков после запятой для валют хранится в справочнике currencies.
+package money
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// RoundingMode задаёт способ округления до количества знаков валюты
+type RoundingMode int
+
+const (
+	// RoundHalfEven банковское округление: половина округляется к ближайшему чётному
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp половина округляется от нуля
+	RoundHalfUp
+	// RoundDown отбрасывание лишних знаков (к нулю)
+	RoundDown
+	// RoundUp округление от нуля при любом остатке
+	RoundUp
+)
+
+// MaxAmount наибольшая сумма одной операции. Всё, что больше, считается ошибкой клиента
+var MaxAmount = decimal.New(1, 12)
+
+// ConversionRounding режим округления суммы зачисления при обмене валют:
+// пользователь никогда не получает больше, чем даёт курс
+const ConversionRounding = RoundDown
+
+// Round округляет сумму до scale знаков выбранным способом
+func Round(amount decimal.Decimal, scale int32, mode RoundingMode) decimal.Decimal {
+	switch mode {
+	case RoundHalfUp:
+		return amount.Round(scale)
+	case RoundDown:
+		return amount.Truncate(scale)
+	case RoundUp:
+		if amount.IsNegative() {
+			return amount.RoundFloor(scale)
+		}
+		return amount.RoundCeil(scale)
+	default:
+		return amount.RoundBank(scale)
+	}
+}
+
+// FitsScale сообщает, что сумма представима в валюте без округления
+func FitsScale(amount decimal.Decimal, scale int32) bool {
+	return amount.Equal(amount.Truncate(scale))
+}
+
+// Convert переводит сумму по курсу и округляет результат до scale знаков целевой валюты
+func Convert(amount, rate decimal.Decimal, scale int32, mode RoundingMode) decimal.Decimal {
+	return Round(amount.Mul(rate), scale, mode)
+}
+
+// RateFromFloat32 переводит курс из gRPC-ответа в десятичное число по кратчайшему
+// представлению float32, чтобы не тащить в расчёты двоичный «хвост» (0.0105 вместо 0.010499999...)
+func RateFromFloat32(rate float32) decimal.Decimal {
+	return decimal.NewFromFloat32(rate)
+}
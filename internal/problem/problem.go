@@ -0,0 +1,152 @@
+// Package problem формирует ответы об ошибках в формате RFC 7807 (application/problem+json).
+// Каждая ошибка имеет стабильный машиночитаемый код, по которому клиент принимает решение,
+// и идентификатор запроса для поиска в логах. Подробности внутренних сбоев в ответ не попадают.
+package problem
+
+import (
+	"github.com/gin-gonic/gin"
+	"gw-currency-wallet/internal/requestid"
+	"gw-currency-wallet/internal/storages"
+	"gw-currency-wallet/internal/validation"
+	"net/http"
+)
+
+// ContentType тип содержимого ответа об ошибке
+const ContentType = "application/problem+json"
+
+// typePrefix префикс URI типа проблемы, к нему добавляется код
+const typePrefix = "urn:gw-currency-wallet:problem:"
+
+// Code стабильный код ошибки. Коды не переименовываются: на них опираются клиенты
+type Code string
+
+const (
+	CodeBadRequest          Code = "bad_request"
+	CodeUnauthorized        Code = "unauthorized"
+	CodeForbidden           Code = "forbidden"
+	CodeEmailNotVerified    Code = "email_not_verified"
+	CodeMFARequired         Code = "mfa_required"
+	CodeNotFound            Code = "not_found"
+	CodeConflict            Code = "conflict"
+	CodeInsufficientFunds   Code = "insufficient_funds"
+	CodeGone                Code = "gone"
+	CodePayloadTooLarge     Code = "payload_too_large"
+	CodeValidationFailed    Code = "validation_failed"
+	CodeUnsupportedCurrency Code = "unsupported_currency"
+	CodeIdempotencyMismatch Code = "idempotency_mismatch"
+	CodeRateLimited         Code = "rate_limited"
+	CodeAccountLocked       Code = "account_locked"
+	CodeRateUnavailable     Code = "rate_unavailable"
+	CodeUnavailable         Code = "unavailable"
+	CodeInternal            Code = "internal"
+)
+
+// statuses HTTP-статус каждого кода
+var statuses = map[Code]int{
+	CodeBadRequest:          http.StatusBadRequest,
+	CodeUnauthorized:        http.StatusUnauthorized,
+	CodeForbidden:           http.StatusForbidden,
+	CodeEmailNotVerified:    http.StatusForbidden,
+	CodeMFARequired:         http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeConflict:            http.StatusConflict,
+	CodeInsufficientFunds:   http.StatusConflict,
+	CodeGone:                http.StatusGone,
+	CodePayloadTooLarge:     http.StatusRequestEntityTooLarge,
+	CodeValidationFailed:    http.StatusUnprocessableEntity,
+	CodeUnsupportedCurrency: http.StatusUnprocessableEntity,
+	CodeIdempotencyMismatch: http.StatusUnprocessableEntity,
+	CodeRateLimited:         http.StatusTooManyRequests,
+	CodeAccountLocked:       http.StatusTooManyRequests,
+	CodeRateUnavailable:     http.StatusServiceUnavailable,
+	CodeUnavailable:         http.StatusServiceUnavailable,
+	CodeInternal:            http.StatusInternalServerError,
+}
+
+// kindCodes коды для классов ошибок хранилища
+var kindCodes = map[storages.Kind]Code{
+	storages.KindNotFound:            CodeNotFound,
+	storages.KindConflict:            CodeConflict,
+	storages.KindInsufficientFunds:   CodeInsufficientFunds,
+	storages.KindUnsupportedCurrency: CodeUnsupportedCurrency,
+	storages.KindRateUnavailable:     CodeRateUnavailable,
+	storages.KindInvalid:             CodeValidationFailed,
+	storages.KindForbidden:           CodeForbidden,
+	storages.KindUnauthorized:        CodeUnauthorized,
+	storages.KindGone:                CodeGone,
+	storages.KindInternal:            CodeInternal,
+}
+
+// Status HTTP-статус кода. Неизвестный код считается внутренней ошибкой
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Problem тело ответа об ошибке (RFC 7807) с расширениями code, request_id и errors
+type Problem struct {
+	Type      string                  `json:"type" example:"urn:gw-currency-wallet:problem:insufficient_funds"`
+	Title     string                  `json:"title" example:"Conflict"`
+	Status    int                     `json:"status" example:"409"`
+	Detail    string                  `json:"detail,omitempty" example:"insufficient funds"`
+	Instance  string                  `json:"instance,omitempty" example:"/api/v1/wallet/withdraw"`
+	Code      Code                    `json:"code" example:"insufficient_funds"`
+	RequestID string                  `json:"request_id,omitempty" example:"3f0c6f1e-0b7e-4c8e-9a57-1c2d3e4f5a6b"`
+	Errors    []validation.FieldError `json:"errors,omitempty"`
+}
+
+// New проблема с кодом code. detail - текст для клиента, он не должен содержать внутренних подробностей
+func New(code Code, detail string) Problem {
+	status := code.Status()
+	return Problem{
+		Type:   typePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// FromError проблема для ошибки хранилища. Текст ошибок хранилища безопасен для клиента,
+// остальные ошибки считаются внутренними и описываются общей фразой
+func FromError(err error) Problem {
+	e, ok := storages.AsError(err)
+	if !ok {
+		return New(CodeInternal, "internal server error")
+	}
+	code, ok := kindCodes[e.Kind]
+	if !ok {
+		code = CodeInternal
+	}
+	return New(code, e.Message)
+}
+
+// Abort отвечает проблемой p и прерывает обработку запроса
+func Abort(c *gin.Context, p Problem) {
+	if p.Instance == "" && c.Request != nil {
+		p.Instance = c.Request.URL.Path
+	}
+	if c.Request != nil {
+		p.RequestID = requestid.FromContext(c.Request.Context())
+	}
+
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Respond отвечает проблемой с кодом code и текстом detail
+func Respond(c *gin.Context, code Code, detail string) {
+	Abort(c, New(code, detail))
+}
+
+// Error отвечает проблемой для ошибки хранилища, см. FromError
+func Error(c *gin.Context, err error) {
+	Abort(c, FromError(err))
+}
+
+// NoRoute ответ на запрос к несуществующему маршруту
+func NoRoute(c *gin.Context) {
+	Respond(c, CodeNotFound, "route not found")
+}
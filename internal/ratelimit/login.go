@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/config"
+	"gw-currency-wallet/internal/storages"
+	"strings"
+	"time"
+)
+
+// LoginStore хранилище неудачных попыток входа
+type LoginStore interface {
+	RecordLoginAttempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (storages.LoginAttempts, bool, error)
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// LoginGuard защита входа от подбора пароля: после нескольких неудач следующая попытка по тому же имени
+// откладывается на растущую задержку, после LockoutThreshold неудач вход блокируется на LockoutDuration.
+// Попытки считаются по имени, а не по пользователю, поэтому несуществующие имена ведут себя так же.
+// Тот же механизм с другим scope защищает от подбора кода TOTP при step-up
+type LoginGuard struct {
+	store LoginStore
+	scope string
+	cfg   config.LoginGuardConfig
+	// delays задержки после 1, 2, ... LockoutThreshold неудач подряд
+	delays []time.Duration
+}
+
+// Scope счётчиков LoginGuard: попытки разных scope для одного имени считаются отдельно
+const (
+	ScopeLogin  = "login"
+	ScopeStepUp = "stepup"
+)
+
+func NewLoginGuard(store LoginStore, scope string, cfg config.LoginGuardConfig) *LoginGuard {
+	g := &LoginGuard{store: store, scope: scope, cfg: cfg}
+	for failures := 1; failures <= max(cfg.LockoutThreshold, 1); failures++ {
+		g.delays = append(g.delays, g.delay(failures))
+	}
+	return g
+}
+
+// key ключ попыток: scope и хеш имени без учёта регистра, само имя не хранится
+func (g *LoginGuard) key(username string) string {
+	return g.scope + ":" + auth.HashRefreshToken(strings.ToLower(username))
+}
+
+// Attempt учитывает попытку входа под именем username до проверки пароля: принятая попытка сразу считается
+// неудачной, верный пароль сбрасывает счётчик через Success. Поэтому пачка параллельных попыток не проходит
+// проверку целиком до того, как учтена первая неудача. wait > 0 - попытка отклонена и повторять её можно
+// не раньше чем через wait; locked == true, если это блокировка после LockoutThreshold неудач, а не задержка
+func (g *LoginGuard) Attempt(ctx context.Context, username string) (wait time.Duration, locked bool, err error) {
+	attempts, allowed, err := g.store.RecordLoginAttempt(ctx, g.key(username), g.cfg.LockoutDuration, g.delays)
+	if err != nil {
+		return 0, false, err
+	}
+	if allowed {
+		return 0, false, nil
+	}
+
+	// Блокировка могла закончиться, пока шёл запрос: клиенту всё равно нужно выждать хотя бы секунду
+	wait = max(time.Until(attempts.BlockedUntil), time.Second)
+	return wait, attempts.Failures >= g.cfg.LockoutThreshold, nil
+}
+
+// Success сбрасывает счётчик неудач после верного пароля
+func (g *LoginGuard) Success(ctx context.Context, username string) error {
+	return g.store.ResetLoginFailures(ctx, g.key(username))
+}
+
+// delay задержка после failures неудач подряд: BaseDelay, удваивается с каждой неудачей до MaxDelay
+func (g *LoginGuard) delay(failures int) time.Duration {
+	if failures >= g.cfg.LockoutThreshold {
+		return g.cfg.LockoutDuration
+	}
+	if failures <= g.cfg.FreeAttempts {
+		return 0
+	}
+
+	d := g.cfg.BaseDelay
+	for i := g.cfg.FreeAttempts + 1; i < failures && d < g.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.MaxDelay)
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"gw-currency-wallet/internal/config"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testLoginConfig = config.LoginGuardConfig{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         30 * time.Second,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+}
+
+func TestLoginGuardDelay(t *testing.T) {
+	g := NewLoginGuard(NewMemory(time.Hour), ScopeLogin, testLoginConfig)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{8, 16 * time.Second},
+		{9, 30 * time.Second}, // 32s ограничено MaxDelay
+		{10, 15 * time.Minute},
+		{25, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := g.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	if len(g.delays) != testLoginConfig.LockoutThreshold {
+		t.Fatalf("len(delays) = %d, want %d", len(g.delays), testLoginConfig.LockoutThreshold)
+	}
+	if last := g.delays[len(g.delays)-1]; last != testLoginConfig.LockoutDuration {
+		t.Errorf("delay after LockoutThreshold failures = %v, want %v", last, testLoginConfig.LockoutDuration)
+	}
+}
+
+// TestLoginGuardAttemptBurst параллельные попытки входа: пропускаются только бесплатные попытки
+// и одна после них, остальные ждут задержку, назначенную предыдущей попыткой
+func TestLoginGuardAttemptBurst(t *testing.T) {
+	g := NewLoginGuard(NewMemory(time.Hour), ScopeLogin, testLoginConfig)
+	ctx := context.Background()
+
+	var (
+		allowed atomic.Int64
+		wg      sync.WaitGroup
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, _, err := g.Attempt(ctx, "alice")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := allowed.Load(), int64(testLoginConfig.FreeAttempts+1); got != want {
+		t.Errorf("allowed attempts = %d, want %d", got, want)
+	}
+
+	wait, locked, err := g.Attempt(ctx, "ALICE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 0 || locked {
+		t.Errorf("attempt after burst: wait = %v, locked = %v, want delay without lock", wait, locked)
+	}
+
+	if err := g.Success(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _, err := g.Attempt(ctx, "alice"); err != nil || wait != 0 {
+		t.Errorf("attempt after success: wait = %v, err = %v, want allowed", wait, err)
+	}
+}
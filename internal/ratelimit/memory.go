@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"gw-currency-wallet/internal/storages"
+	"sync"
+	"time"
+)
+
+// sweepInterval как часто Memory удаляет полные корзины и устаревшие попытки входа
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	bucket storages.TokenBucket
+	// fullAt момент, когда корзина наполнится: после него запись можно удалить без изменения поведения
+	fullAt time.Time
+}
+
+// Memory хранилище счётчиков в памяти процесса. Подходит для одного экземпляра сервиса и для локального запуска
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]memoryBucket
+	logins    map[string]storages.LoginAttempts
+	lastSweep time.Time
+	// loginTTL сколько хранить попытки входа без новых неудач
+	loginTTL time.Duration
+}
+
+// NewMemory хранилище в памяти. loginTTL - сколько помнить неудачные попытки входа, обычно срок блокировки
+func NewMemory(loginTTL time.Duration) *Memory {
+	return &Memory{
+		buckets:   make(map[string]memoryBucket),
+		logins:    make(map[string]storages.LoginAttempts),
+		lastSweep: time.Now(),
+		loginTTL:  loginTTL,
+	}
+}
+
+func (m *Memory) TakeRateLimitToken(_ context.Context, key string, burst int, interval time.Duration) (storages.RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	bucket, res := m.buckets[key].bucket.Take(now, burst, interval)
+	m.buckets[key] = memoryBucket{bucket: bucket, fullAt: now.Add(res.ResetAfter)}
+	return res, nil
+}
+
+func (m *Memory) RecordLoginAttempt(_ context.Context, key string, window time.Duration, delays []time.Duration) (storages.LoginAttempts, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	attempts := m.logins[key]
+	if now.Before(attempts.BlockedUntil) {
+		return attempts, false, nil
+	}
+
+	if attempts.LastFailedAt.Before(now.Add(-window)) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.LastFailedAt = now
+	attempts.BlockedUntil = now.Add(delays[min(attempts.Failures, len(delays))-1])
+	m.logins[key] = attempts
+
+	return attempts, true, nil
+}
+
+func (m *Memory) ResetLoginFailures(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.logins, key)
+	return nil
+}
+
+// sweep удаляет полные корзины и попытки входа старше loginTTL, чтобы память не росла с числом клиентов.
+// Вызывается под m.mu
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if now.After(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+	for key, a := range m.logins {
+		if now.Sub(a.LastFailedAt) > m.loginTTL && now.After(a.BlockedUntil) {
+			delete(m.logins, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package ratelimit ограничивает частоту запросов корзинами токенов (token bucket) по IP клиента
+// или по пользователю и защищает вход от подбора пароля. Счётчики хранятся в памяти процесса
+// или в PostgreSQL, если экземпляров сервиса несколько.
+package ratelimit
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/auth"
+	"gw-currency-wallet/internal/config"
+	"gw-currency-wallet/internal/logging"
+	"gw-currency-wallet/internal/problem"
+	"gw-currency-wallet/internal/storages"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Заголовки ответа (draft-ietf-httpapi-ratelimit-headers)
+const (
+	HeaderLimit      = "RateLimit-Limit"
+	HeaderRemaining  = "RateLimit-Remaining"
+	HeaderReset      = "RateLimit-Reset"
+	HeaderPolicy     = "RateLimit-Policy"
+	HeaderRetryAfter = "Retry-After"
+)
+
+// Store хранилище корзин токенов
+type Store interface {
+	TakeRateLimitToken(ctx context.Context, key string, burst int, interval time.Duration) (storages.RateLimitResult, error)
+}
+
+// Backend хранилище корзин и неудачных попыток входа. Ему соответствуют Memory и postgres.PSQL
+type Backend interface {
+	Store
+	LoginStore
+}
+
+// KeyFunc ключ, по которому считаются запросы
+type KeyFunc func(c *gin.Context) string
+
+// ByIP считает запросы по IP клиента. IP берётся из X-Forwarded-For только от доверенных прокси
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser считает запросы по пользователю из access-токена, без токена - по IP. Должен стоять после auth.Auth()
+func ByUser(c *gin.Context) string {
+	if p, ok := auth.PrincipalFrom(c); ok {
+		return "user:" + strconv.Itoa(p.UserID)
+	}
+	return ByIP(c)
+}
+
+// Middleware ограничивает запросы группы маршрутов name лимитом limit, счёт ведётся отдельно для каждого ключа.
+// Выключенный лимит ничего не проверяет. Если хранилище недоступно, запрос пропускается:
+// сбой счётчиков не должен останавливать сервис
+func Middleware(store Store, name string, limit config.RateLimit, key KeyFunc, logger *zap.Logger) gin.HandlerFunc {
+	if !limit.Enabled() {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	interval := limit.Period / time.Duration(limit.Requests)
+	policy := strconv.Itoa(limit.Requests) + ";w=" + strconv.Itoa(seconds(limit.Period))
+
+	return func(c *gin.Context) {
+		res, err := store.TakeRateLimitToken(c, name+":"+key(c), limit.Requests, interval)
+		if err != nil {
+			logging.FromContext(c, logger).Error("Could not check rate limit", zap.String("group", name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		setHeaders(c, res, policy)
+		if !res.Allowed {
+			SetRetryAfter(c, res.RetryAfter)
+			problem.Respond(c, problem.CodeRateLimited, "too many requests, retry later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// SetRetryAfter выставляет Retry-After: через сколько секунд можно повторить запрос
+func SetRetryAfter(c *gin.Context, d time.Duration) {
+	c.Header(HeaderRetryAfter, strconv.Itoa(max(seconds(d), 1)))
+}
+
+// setHeaders выставляет заголовки RateLimit-*. Если маршрут проходит через несколько лимитов,
+// в ответе остаётся самый строгий из них - с наименьшим остатком
+func setHeaders(c *gin.Context, res storages.RateLimitResult, policy string) {
+	if prev := c.Writer.Header().Get(HeaderRemaining); prev != "" {
+		if n, err := strconv.Atoi(prev); err == nil && n < res.Remaining {
+			return
+		}
+	}
+
+	c.Header(HeaderLimit, strconv.Itoa(res.Limit))
+	c.Header(HeaderRemaining, strconv.Itoa(res.Remaining))
+	c.Header(HeaderReset, strconv.Itoa(seconds(res.ResetAfter)))
+	c.Header(HeaderPolicy, policy)
+}
+
+// seconds длительность в целых секундах с округлением вверх: клиент, подождавший столько, не получит отказ снова
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,34 @@
+// Package requestbody читает тело запроса целиком в middleware, которым оно нужно до обработчика
+// (хеш для идемпотентности, сумма для step-up). Размер тела ограничен, чтобы клиент не заставил сервер
+// держать в памяти произвольно большой запрос.
+package requestbody
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gw-currency-wallet/internal/problem"
+	"io"
+	"net/http"
+)
+
+// MaxSize наибольший размер тела запроса, который читается в память
+const MaxSize = 64 << 10
+
+// Read читает тело запроса не больше MaxSize байт и подменяет его копией, чтобы обработчик прочитал тело снова.
+// Слишком большое тело - 413, ошибка чтения - 400. ok == false означает, что ответ уже отправлен
+func Read(c *gin.Context) (body []byte, ok bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxSize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		problem.Respond(c, problem.CodePayloadTooLarge, "request body is too large")
+		return nil, false
+	case err != nil:
+		problem.Respond(c, problem.CodeBadRequest, "could not read request body")
+		return nil, false
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
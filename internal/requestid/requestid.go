@@ -0,0 +1,57 @@
+// Package requestid хранит идентификатор запроса в контексте, чтобы связать
+// ответ клиенту, логи и записи в БД, относящиеся к одному HTTP-запросу.
+package requestid
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Header заголовок, в котором клиент может передать свой идентификатор запроса
+const Header = "X-Request-ID"
+
+const maxLen = 128
+
+type ctxKey struct{}
+
+// NewContext возвращает копию ctx с идентификатором запроса
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Middleware принимает X-Request-ID клиента или генерирует новый и возвращает его в ответе
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !valid(id) {
+			id = uuid.NewString()
+		}
+
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// valid допускает только короткие идентификаторы из безопасных символов,
+// так как значение попадает в логи и в БД
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
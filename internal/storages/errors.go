@@ -0,0 +1,78 @@
+package storages
+
+import "errors"
+
+// Kind класс ошибки хранилища. По нему обработчики выбирают код ошибки и HTTP-статус ответа,
+// не разбирая отдельные ошибки
+type Kind string
+
+const (
+	KindNotFound            Kind = "not_found"
+	KindConflict            Kind = "conflict"
+	KindInsufficientFunds   Kind = "insufficient_funds"
+	KindUnsupportedCurrency Kind = "unsupported_currency"
+	KindRateUnavailable     Kind = "rate_unavailable"
+	KindInvalid             Kind = "validation_failed"
+	KindForbidden           Kind = "forbidden"
+	KindUnauthorized        Kind = "unauthorized"
+	KindGone                Kind = "gone"
+	// KindInternal любая ошибка, не описанная в этом файле: сбой БД, нарушение инварианта
+	KindInternal Kind = "internal"
+)
+
+// Error ошибка хранилища с классом. Текст безопасен для клиента, подробности сбоев в него не попадают
+type Error struct {
+	Kind    Kind
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// AsError ошибка хранилища из цепочки err. ok == false для внутренних ошибок
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// KindOf класс ошибки, KindInternal для ошибок без класса
+func KindOf(err error) Kind {
+	if e, ok := AsError(err); ok {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+var (
+	ErrUserNotFound        = newError(KindNotFound, "user not found")
+	ErrUserExists          = newError(KindConflict, "username or email is already taken")
+	ErrWalletNotFound      = newError(KindNotFound, "wallet not found")
+	ErrWalletFrozen        = newError(KindForbidden, "wallet is frozen")
+	ErrUnsupportedCurrency = newError(KindUnsupportedCurrency, "unsupported currency")
+	ErrSameCurrency        = newError(KindInvalid, "currencies must be different")
+	ErrInvalidAmount       = newError(KindInvalid, "amount must be positive")
+	ErrAmountPrecision     = newError(KindInvalid, "amount has more decimal places than the currency allows")
+	ErrInvalidRate         = newError(KindRateUnavailable, "invalid exchange rate")
+	ErrInsufficientFunds   = newError(KindInsufficientFunds, "insufficient funds")
+	ErrRecipientNotFound   = newError(KindNotFound, "recipient not found")
+	ErrSelfTransfer        = newError(KindInvalid, "cannot transfer to own wallet")
+	ErrQuoteNotFound       = newError(KindNotFound, "quote not found")
+	ErrQuoteExpired        = newError(KindGone, "quote has expired")
+	ErrQuoteUsed           = newError(KindConflict, "quote has already been used")
+	ErrSessionNotFound     = newError(KindNotFound, "session not found")
+	ErrRefreshTokenInvalid = newError(KindUnauthorized, "refresh token is invalid or expired")
+	ErrRefreshTokenReused  = newError(KindUnauthorized, "refresh token has already been used")
+	ErrMFANotEnrolled      = newError(KindNotFound, "two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled   = newError(KindConflict, "two-factor authentication is already enabled")
+	ErrTOTPInvalid         = newError(KindUnauthorized, "invalid one-time code")
+	ErrMFAChallengeInvalid = newError(KindUnauthorized, "mfa challenge is invalid or expired")
+	ErrUserTokenInvalid    = newError(KindInvalid, "token is invalid or expired")
+)
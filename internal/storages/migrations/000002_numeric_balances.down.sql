@@ -0,0 +1,4 @@
+ALTER TABLE wallets
+    ALTER COLUMN balanceRUB TYPE float USING balanceRUB::float,
+    ALTER COLUMN balanceUSD TYPE float USING balanceUSD::float,
+    ALTER COLUMN balanceEUR TYPE float USING balanceEUR::float;
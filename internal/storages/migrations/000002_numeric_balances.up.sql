@@ -0,0 +1,6 @@
+-- Балансы хранятся как точные десятичные числа: 2 знака после запятой для RUB, USD, EUR по ISO 4217.
+-- Накопленная двоичная погрешность float округляется до копеек/центов.
+ALTER TABLE wallets
+    ALTER COLUMN balanceRUB TYPE NUMERIC(20, 2) USING round(balanceRUB::numeric, 2),
+    ALTER COLUMN balanceUSD TYPE NUMERIC(20, 2) USING round(balanceUSD::numeric, 2),
+    ALTER COLUMN balanceEUR TYPE NUMERIC(20, 2) USING round(balanceEUR::numeric, 2);
@@ -0,0 +1,21 @@
+-- История операций. Списание описывается полями from_*, зачисление - полями to_*:
+-- у пополнения заполнена только сторона to, у снятия - только from, у обмена - обе.
+CREATE TABLE IF NOT EXISTS transactions
+(
+    id                  BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    wallet_id           INT         NOT NULL REFERENCES wallets (id),
+    type                varchar     NOT NULL,
+    from_currency       varchar,
+    from_amount         NUMERIC,
+    from_balance_before NUMERIC,
+    from_balance_after  NUMERIC,
+    to_currency         varchar,
+    to_amount           NUMERIC,
+    to_balance_before   NUMERIC,
+    to_balance_after    NUMERIC,
+    rate                NUMERIC,
+    request_id          varchar,
+    created_at          timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_wallet_id ON transactions (wallet_id, id DESC);
@@ -0,0 +1,48 @@
+-- Двойная запись: каждая операция - журнал из проводок с нулевой суммой по каждой валюте.
+-- amount > 0 - кредит счёта (увеличивает баланс кошелька), amount < 0 - дебет.
+-- Балансы в wallets - проекция, которую можно пересчитать по ledger_entries.
+CREATE TABLE ledger_accounts
+(
+    id        INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    code      varchar NOT NULL UNIQUE,
+    wallet_id INT UNIQUE REFERENCES wallets (id)
+);
+
+CREATE TABLE ledger_entries
+(
+    id             BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    journal_id     uuid        NOT NULL,
+    transaction_id BIGINT REFERENCES transactions (id),
+    account_id     INT         NOT NULL REFERENCES ledger_accounts (id),
+    currency       varchar     NOT NULL,
+    amount         NUMERIC     NOT NULL CHECK ( amount <> 0 ),
+    created_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_ledger_entries_account ON ledger_entries (account_id, currency);
+CREATE INDEX idx_ledger_entries_journal ON ledger_entries (journal_id);
+
+INSERT INTO ledger_accounts (code)
+VALUES ('system:cash_in'),
+       ('system:cash_out'),
+       ('system:fx');
+
+INSERT INTO ledger_accounts (code, wallet_id)
+SELECT 'wallet:' || uuid, id
+FROM wallets;
+
+-- Входящие остатки существующих кошельков проводятся как пополнение со счёта cash_in
+WITH opening AS MATERIALIZED (SELECT gen_random_uuid() AS journal_id, a.id AS account_id, b.currency, b.amount
+                              FROM wallets w
+                                       JOIN ledger_accounts a ON a.wallet_id = w.id
+                                       CROSS JOIN LATERAL (VALUES ('RUB', w.balanceRUB),
+                                                                  ('USD', w.balanceUSD),
+                                                                  ('EUR', w.balanceEUR)) AS b(currency, amount)
+                              WHERE b.amount <> 0)
+INSERT
+INTO ledger_entries (journal_id, account_id, currency, amount)
+SELECT o.journal_id, e.account_id, o.currency, e.amount
+FROM opening o
+         CROSS JOIN LATERAL (VALUES (o.account_id, o.amount),
+                                    ((SELECT id FROM ledger_accounts WHERE code = 'system:cash_in'), -o.amount))
+    AS e(account_id, amount);
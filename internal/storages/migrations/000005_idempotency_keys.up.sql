@@ -0,0 +1,16 @@
+-- Ключи идемпотентности денежных операций и сохранённые ответы на них.
+-- status_code IS NULL - запрос с этим ключом ещё выполняется
+CREATE TABLE idempotency_keys
+(
+    owner         varchar     NOT NULL,
+    key           varchar     NOT NULL,
+    request_hash  varchar     NOT NULL,
+    status_code   INT,
+    content_type  varchar,
+    response_body bytea,
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    expires_at    timestamptz NOT NULL,
+    PRIMARY KEY (owner, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
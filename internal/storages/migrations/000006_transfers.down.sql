@@ -0,0 +1,3 @@
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS counterparty_wallet_id,
+    DROP COLUMN IF EXISTS memo;
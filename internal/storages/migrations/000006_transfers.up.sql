@@ -0,0 +1,4 @@
+-- Переводы между кошельками: у каждой стороны своя запись в истории со ссылкой на кошелёк контрагента
+ALTER TABLE transactions
+    ADD COLUMN counterparty_wallet_id INT REFERENCES wallets (id),
+    ADD COLUMN memo                   varchar;
@@ -0,0 +1,17 @@
+-- Котировки обмена: курс и суммы фиксируются при выдаче, обмен по котировке возможен один раз до expires_at
+CREATE TABLE IF NOT EXISTS exchange_quotes
+(
+    id             uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    wallet_id      INT         NOT NULL REFERENCES wallets (id),
+    from_currency  varchar     NOT NULL,
+    to_currency    varchar     NOT NULL,
+    rate           NUMERIC     NOT NULL,
+    from_amount    NUMERIC     NOT NULL,
+    to_amount      NUMERIC     NOT NULL,
+    created_at     timestamptz NOT NULL DEFAULT now(),
+    expires_at     timestamptz NOT NULL,
+    used_at        timestamptz,
+    transaction_id BIGINT REFERENCES transactions (id)
+);
+
+CREATE INDEX IF NOT EXISTS exchange_quotes_expires_at_idx ON exchange_quotes (expires_at) WHERE used_at IS NULL;
@@ -0,0 +1,13 @@
+-- Балансы в валютах, кроме RUB, USD и EUR, при откате теряются
+ALTER TABLE wallets
+    ADD COLUMN balanceRUB NUMERIC(20, 2) DEFAULT 0 CHECK ( balanceRUB >= 0 ),
+    ADD COLUMN balanceUSD NUMERIC(20, 2) DEFAULT 0 CHECK ( balanceUSD >= 0 ),
+    ADD COLUMN balanceEUR NUMERIC(20, 2) DEFAULT 0 CHECK ( balanceEUR >= 0 );
+
+UPDATE wallets w
+SET balanceRUB = COALESCE((SELECT amount FROM wallet_balances b WHERE b.wallet_id = w.id AND b.currency = 'RUB'), 0),
+    balanceUSD = COALESCE((SELECT amount FROM wallet_balances b WHERE b.wallet_id = w.id AND b.currency = 'USD'), 0),
+    balanceEUR = COALESCE((SELECT amount FROM wallet_balances b WHERE b.wallet_id = w.id AND b.currency = 'EUR'), 0);
+
+DROP TABLE IF EXISTS wallet_balances;
+DROP TABLE IF EXISTS currencies;
@@ -0,0 +1,37 @@
+-- Справочник валют: код ISO 4217, количество знаков после запятой (minor unit), название.
+-- Новая валюта добавляется строкой в справочник, отключённая валюта недоступна для новых операций
+CREATE TABLE IF NOT EXISTS currencies
+(
+    code    varchar PRIMARY KEY,
+    scale   SMALLINT NOT NULL CHECK ( scale BETWEEN 0 AND 8 ),
+    name    varchar  NOT NULL,
+    enabled boolean  NOT NULL DEFAULT true
+);
+
+INSERT INTO currencies (code, scale, name)
+VALUES ('RUB', 2, 'Российский рубль'),
+       ('USD', 2, 'Доллар США'),
+       ('EUR', 2, 'Евро')
+ON CONFLICT (code) DO NOTHING;
+
+-- Балансы кошельков по валютам. Строка появляется при первом зачислении, отсутствие строки - нулевой баланс
+CREATE TABLE IF NOT EXISTS wallet_balances
+(
+    wallet_id INT     NOT NULL REFERENCES wallets (id),
+    currency  varchar NOT NULL REFERENCES currencies (code),
+    amount    NUMERIC NOT NULL DEFAULT 0 CHECK ( amount >= 0 ),
+    PRIMARY KEY (wallet_id, currency)
+);
+
+INSERT INTO wallet_balances (wallet_id, currency, amount)
+SELECT w.id, b.currency, b.amount
+FROM wallets w
+         CROSS JOIN LATERAL (VALUES ('RUB', w.balanceRUB),
+                                    ('USD', w.balanceUSD),
+                                    ('EUR', w.balanceEUR)) AS b(currency, amount)
+WHERE b.amount <> 0;
+
+ALTER TABLE wallets
+    DROP COLUMN balanceRUB,
+    DROP COLUMN balanceUSD,
+    DROP COLUMN balanceEUR;
@@ -0,0 +1,36 @@
+-- Сессии пользователей. Сессия - семейство refresh-токенов, выданных при одном входе
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id           uuid PRIMARY KEY,
+    user_id      INT         NOT NULL REFERENCES users (id),
+    user_agent   varchar     NOT NULL DEFAULT '',
+    ip           varchar     NOT NULL DEFAULT '',
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    last_used_at timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL,
+    revoked_at   timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+-- Refresh-токены хранятся только в виде SHA-256. Каждый токен одноразовый: при обновлении
+-- помечается использованным и заменяется новым. Вместе с токеном запоминается выданный с ним access-токен
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    token_hash        varchar PRIMARY KEY,
+    session_id        uuid        NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    access_jti        uuid        NOT NULL,
+    access_expires_at timestamptz NOT NULL,
+    created_at        timestamptz NOT NULL DEFAULT now(),
+    expires_at        timestamptz NOT NULL,
+    used_at           timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON refresh_tokens (session_id);
+
+-- Отозванные до истечения срока access-токены
+CREATE TABLE IF NOT EXISTS revoked_access_tokens
+(
+    jti        uuid PRIMARY KEY,
+    expires_at timestamptz NOT NULL
+);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS admin_audit_log;
+
+DELETE FROM ledger_accounts a
+WHERE a.code = 'system:adjustments'
+  AND NOT EXISTS (SELECT 1 FROM ledger_entries e WHERE e.account_id = a.id);
+
+ALTER TABLE wallets
+    DROP COLUMN IF EXISTS frozen_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,32 @@
+-- Роли пользователей: user - владелец кошелька, support - просмотр и заморозка чужих кошельков,
+-- admin - вдобавок ручные корректировки и смена ролей. Первый администратор назначается вручную:
+-- UPDATE users SET role = 'admin' WHERE username = '...'
+ALTER TABLE users
+    ADD COLUMN role       varchar     NOT NULL DEFAULT 'user' CHECK ( role IN ('user', 'support', 'admin') ),
+    ADD COLUMN created_at timestamptz NOT NULL DEFAULT now();
+
+-- Замороженный кошелёк не участвует в операциях пользователей, корректировки администратора допускаются
+ALTER TABLE wallets
+    ADD COLUMN frozen_at timestamptz;
+
+-- Счёт ручных корректировок в главной книге
+INSERT INTO ledger_accounts (code)
+VALUES ('system:adjustments')
+ON CONFLICT (code) DO NOTHING;
+
+-- Журнал действий в административном API. Запись об изменении делается в той же транзакции, что и само изменение
+CREATE TABLE IF NOT EXISTS admin_audit_log
+(
+    id               BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    actor_id         INT         NOT NULL REFERENCES users (id),
+    action           varchar     NOT NULL,
+    target_user_id   INT REFERENCES users (id),
+    target_wallet_id INT REFERENCES wallets (id),
+    reason           varchar,
+    details          jsonb,
+    request_id       varchar,
+    created_at       timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS admin_audit_log_target_wallet_idx ON admin_audit_log (target_wallet_id, id DESC);
+CREATE INDEX IF NOT EXISTS admin_audit_log_actor_idx ON admin_audit_log (actor_id, id DESC);
@@ -0,0 +1,32 @@
+-- Второй фактор TOTP (RFC 6238). Секрет начинает действовать после подтверждения первым кодом.
+-- last_step - шаг последнего принятого кода: один и тот же код дважды не принимается
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id      INT PRIMARY KEY REFERENCES users (id),
+    secret       varchar     NOT NULL,
+    last_step    BIGINT      NOT NULL DEFAULT 0,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    confirmed_at timestamptz
+);
+
+-- Одноразовые коды восстановления, хранятся только в виде SHA-256
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    user_id   INT     NOT NULL REFERENCES users (id),
+    code_hash varchar NOT NULL,
+    used_at   timestamptz,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- Токены второго шага входа: выдаются после проверки пароля пользователю с включённым TOTP
+CREATE TABLE IF NOT EXISTS mfa_challenges
+(
+    token_hash varchar PRIMARY KEY,
+    user_id    INT         NOT NULL REFERENCES users (id),
+    attempts   INT         NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS mfa_challenges_expires_at_idx ON mfa_challenges (expires_at);
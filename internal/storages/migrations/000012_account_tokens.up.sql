@@ -0,0 +1,19 @@
+-- Подтверждение email. Уже зарегистрированные пользователи считаются подтверждёнными,
+-- новые до подтверждения могут только просматривать данные
+ALTER TABLE users
+    ADD COLUMN email_verified_at timestamptz;
+
+UPDATE users SET email_verified_at = now();
+
+-- Одноразовые токены из писем: подтверждение email и сброс пароля. Хранятся только в виде SHA-256
+CREATE TABLE IF NOT EXISTS user_tokens
+(
+    token_hash varchar PRIMARY KEY,
+    user_id    INT         NOT NULL REFERENCES users (id),
+    purpose    varchar     NOT NULL CHECK ( purpose IN ('email_verification', 'password_reset') ),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS user_tokens_user_id_idx ON user_tokens (user_id, purpose);
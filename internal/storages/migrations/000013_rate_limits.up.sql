@@ -0,0 +1,20 @@
+-- Корзины токенов ограничения частоты запросов, общие для всех экземпляров сервиса.
+-- tokens - остаток на момент updated_at, дальше корзина пополняется равномерно
+CREATE TABLE IF NOT EXISTS rate_limits
+(
+    key        varchar          PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at timestamptz      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_updated_at_idx ON rate_limits (updated_at);
+
+-- Неудачные попытки входа по имени пользователя (хранится SHA-256 имени).
+-- Учитываются и несуществующие имена, чтобы по блокировке нельзя было узнать, есть ли пользователь
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    key            varchar     PRIMARY KEY,
+    failures       INT         NOT NULL,
+    last_failed_at timestamptz NOT NULL,
+    blocked_until  timestamptz
+);
@@ -1,38 +1,281 @@
 package storages
 
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
 type User struct {
 	ID       int    `json:"-"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Email    string `json:"email"`
-	//WalletID int    //TODO: нужно ли это?
+
+	PasswordHash string `json:"-"`
+	WalletUUID   string `json:"-"`
+	Role         string `json:"-"`
+	// EmailVerified пользователь с неподтверждённым email может только просматривать данные
+	EmailVerified bool `json:"-"`
+}
+
+// Роли пользователей. Права ролей описаны в пакете auth
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// Назначения одноразовых токенов из писем
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
+// UserSummary пользователь в выдаче административного поиска
+type UserSummary struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	WalletUUID   string    `json:"wallet_uuid"`
+	WalletFrozen bool      `json:"wallet_frozen"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UserFilter параметры поиска пользователей. Query ищется как подстрока в имени и email,
+// AfterID - курсор: id последнего пользователя предыдущей страницы
+type UserFilter struct {
+	Query   string
+	Role    string
+	AfterID int
+	Limit   int
 }
 
+// Session сессия пользователя: семейство refresh-токенов одного входа.
+// Current выставляется для сессии, которой принадлежит токен запроса
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// RefreshToken выпускаемый refresh-токен: хеш самого токена и access-токен, выданный вместе с ним
+type RefreshToken struct {
+	Hash            string
+	ExpiresAt       time.Time
+	AccessJTI       string
+	AccessExpiresAt time.Time
+}
+
+// TOTP второй фактор пользователя. Секрет действует после подтверждения первым кодом (Confirmed),
+// LastStep - шаг последнего принятого кода
+type TOTP struct {
+	Secret    string
+	Confirmed bool
+	LastStep  int64
+}
+
+// Currency валюта из справочника. Scale - количество знаков после запятой (minor unit),
+// суммы в валюте не могут быть точнее
 type Currency struct {
-	RUB float64 `json:"rub"`
-	USD float64 `json:"usd"`
-	EUR float64 `json:"eur"`
+	Code    string `json:"code"`
+	Scale   int32  `json:"scale"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"-"`
 }
+
+// Balances балансы по кодам валют. Суммы хранятся как точные десятичные числа и в JSON передаются строками
+type Balances map[string]decimal.Decimal
+
 type Wallet struct {
 	ID      int      `json:"id"`
 	UUID    string   `json:"uuid"`
-	Balance Currency `json:"balance"`
+	Balance Balances `json:"balance" swaggertype:"object,string" example:"RUB:100.50,USD:10.00"`
+	// Frozen замороженный кошелёк не участвует в операциях пользователей
+	Frozen bool `json:"frozen"`
 }
 
+// Deposit сумма принимается как строкой ("10.25"), так и числом
 type Deposit struct {
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+	Amount   decimal.Decimal `json:"amount" binding:"required,positive,max_amount,scale=Currency" swaggertype:"string" example:"10.25"`
+	Currency string          `json:"currency" binding:"required,currency" example:"USD"`
 }
 
 type Withdraw struct {
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+	Amount   decimal.Decimal `json:"amount" binding:"required,positive,max_amount,scale=Currency" swaggertype:"string" example:"10.25"`
+	Currency string          `json:"currency" binding:"required,currency" example:"USD"`
 }
 
+// Exchanger запрос обмена. Если указан quote_id, обмен выполняется по котировке,
+// а валюты и сумма берутся из неё
 type Exchanger struct {
-	FromCurrency string  `json:"from_currency"`
-	ToCurrency   string  `json:"to_currency"`
-	Amount       float64 `json:"amount"`
+	FromCurrency string          `json:"from_currency" binding:"required_without=QuoteID,omitempty,currency" example:"USD"`
+	ToCurrency   string          `json:"to_currency" binding:"required_without=QuoteID,omitempty,currency,nefield=FromCurrency" example:"EUR"`
+	Amount       decimal.Decimal `json:"amount" binding:"required_without=QuoteID,omitempty,positive,max_amount,scale=FromCurrency" swaggertype:"string" example:"10.25"`
+	QuoteID      string          `json:"quote_id,omitempty" binding:"omitempty,uuid"`
 }
 
-type Rates Currency
+// Quote котировка обмена: курс и суммы зафиксированы до ExpiresAt
+type Quote struct {
+	ID           string          `json:"quote_id"`
+	FromCurrency string          `json:"from_currency"`
+	ToCurrency   string          `json:"to_currency"`
+	Rate         decimal.Decimal `json:"rate" swaggertype:"string" example:"0.0105"`
+	FromAmount   decimal.Decimal `json:"from_amount" swaggertype:"string" example:"1000.00"`
+	ToAmount     decimal.Decimal `json:"to_amount" swaggertype:"string" example:"10.50"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+}
+
+// Transfer перевод другому пользователю. Получатель задаётся ровно одним из полей
+// to_username, to_email или to_wallet_uuid
+type Transfer struct {
+	ToUsername   string          `json:"to_username,omitempty" binding:"required_without_all=ToEmail ToWalletUUID,excluded_with=ToEmail ToWalletUUID"`
+	ToEmail      string          `json:"to_email,omitempty" binding:"excluded_with=ToWalletUUID,omitempty,email"`
+	ToWalletUUID string          `json:"to_wallet_uuid,omitempty" binding:"omitempty,uuid"`
+	Currency     string          `json:"currency" binding:"required,currency" example:"USD"`
+	Amount       decimal.Decimal `json:"amount" binding:"required,positive,max_amount,scale=Currency" swaggertype:"string" example:"10.25"`
+	Memo         string          `json:"memo,omitempty" binding:"max=255"`
+}
+
+// Rates курсы по кодам валют
+type Rates map[string]decimal.Decimal
+
+// Типы операций в истории транзакций
+const (
+	TransactionDeposit  = "deposit"
+	TransactionWithdraw = "withdraw"
+	TransactionExchange = "exchange"
+	// Перевод записывается двумя операциями: списание у отправителя и зачисление получателю
+	TransactionTransferOut = "transfer_out"
+	TransactionTransferIn  = "transfer_in"
+	// Ручная корректировка администратора: зачисление заполняет сторону to, списание - сторону from
+	TransactionAdjustment = "adjustment"
+)
+
+// Transaction запись истории операций кошелька.
+// Сторона from описывает списание, сторона to - зачисление
+type Transaction struct {
+	ID                int64               `json:"id"`
+	WalletID          int                 `json:"-"`
+	Type              string              `json:"type"`
+	FromCurrency      string              `json:"from_currency,omitempty"`
+	FromAmount        decimal.NullDecimal `json:"from_amount" swaggertype:"string"`
+	FromBalanceBefore decimal.NullDecimal `json:"from_balance_before" swaggertype:"string"`
+	FromBalanceAfter  decimal.NullDecimal `json:"from_balance_after" swaggertype:"string"`
+	ToCurrency        string              `json:"to_currency,omitempty"`
+	ToAmount          decimal.NullDecimal `json:"to_amount" swaggertype:"string"`
+	ToBalanceBefore   decimal.NullDecimal `json:"to_balance_before" swaggertype:"string"`
+	ToBalanceAfter    decimal.NullDecimal `json:"to_balance_after" swaggertype:"string"`
+	Rate              decimal.NullDecimal `json:"rate" swaggertype:"string"`
+	// Кошелёк второй стороны перевода
+	CounterpartyWalletID   int       `json:"-"`
+	CounterpartyWalletUUID string    `json:"counterparty_wallet_uuid,omitempty"`
+	Memo                   string    `json:"memo,omitempty"`
+	RequestID              string    `json:"request_id,omitempty"`
+	CreatedAt              time.Time `json:"created_at"`
+}
+
+// TransactionFilter параметры выборки истории. Нулевые значения означают отсутствие фильтра.
+// Записи возвращаются от новых к старым, AfterID - курсор: id последней записи предыдущей страницы
+type TransactionFilter struct {
+	Type     string
+	Currency string
+	Since    time.Time
+	Until    time.Time
+	AfterID  int64
+	Limit    int
+}
+
+// Adjustment ручная корректировка баланса. Amount > 0 - зачисление, Amount < 0 - списание.
+// Нулевая сумма не проходит required, как и в остальных запросах с суммой
+type Adjustment struct {
+	Currency string          `json:"currency" binding:"required,currency" example:"USD"`
+	Amount   decimal.Decimal `json:"amount" binding:"required,max_amount,scale=Currency" swaggertype:"string" example:"-10.25"`
+	Reason   string          `json:"reason" binding:"required,notblank,max=255"`
+}
+
+// Действия административного API в журнале аудита
+const (
+	AuditUserSearch     = "user.search"
+	AuditUserRole       = "user.role"
+	AuditWalletView     = "wallet.view"
+	AuditWalletHistory  = "wallet.history"
+	AuditWalletFreeze   = "wallet.freeze"
+	AuditWalletUnfreeze = "wallet.unfreeze"
+	AuditWalletAdjust   = "wallet.adjust"
+)
+
+// AuditEntry запись журнала действий администраторов и поддержки
+type AuditEntry struct {
+	ID               int64          `json:"id"`
+	ActorID          int            `json:"actor_id"`
+	Action           string         `json:"action"`
+	TargetUserID     int            `json:"target_user_id,omitempty"`
+	TargetWalletUUID string         `json:"target_wallet_uuid,omitempty"`
+	Reason           string         `json:"reason,omitempty"`
+	Details          map[string]any `json:"details,omitempty"`
+	RequestID        string         `json:"request_id,omitempty"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
+
+// AuditFilter параметры выборки журнала аудита, нулевые значения означают отсутствие фильтра
+type AuditFilter struct {
+	ActorID          int
+	TargetWalletUUID string
+	Action           string
+	AfterID          int64
+	Limit            int
+}
+
+// LedgerReport результат сверки главной книги
+type LedgerReport struct {
+	Totals             []LedgerTotal
+	UnbalancedJournals int
+	Mismatches         []BalanceMismatch
+}
+
+// OK сообщает, что книга сбалансирована и балансы кошельков совпадают с ней
+func (r LedgerReport) OK() bool {
+	for _, t := range r.Totals {
+		if !t.Sum.IsZero() {
+			return false
+		}
+	}
+	return r.UnbalancedJournals == 0 && len(r.Mismatches) == 0
+}
+
+// LedgerTotal сумма всех проводок в валюте, в сбалансированной книге равна нулю
+type LedgerTotal struct {
+	Currency string
+	Sum      decimal.Decimal
+}
+
+// BalanceMismatch расхождение баланса кошелька с остатком его счёта в книге
+type BalanceMismatch struct {
+	WalletUUID string
+	Currency   string
+	Balance    decimal.Decimal
+	Ledger     decimal.Decimal
+}
+
+// BalanceTotal сумма балансов всех кошельков в валюте. Wallets - число кошельков с ненулевым балансом
+type BalanceTotal struct {
+	Currency string
+	Amount   decimal.Decimal
+	Wallets  int
+}
+
+// IdempotencyRecord ключ идемпотентности и сохранённый ответ на первый запрос с ним
+type IdempotencyRecord struct {
+	RequestHash string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
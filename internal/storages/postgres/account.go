@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+// useUserToken гасит действующий токен с назначением purpose и возвращает id пользователя.
+// Неизвестный, истёкший или использованный токен - storages.ErrUserTokenInvalid
+func useUserToken(ctx context.Context, tx pgx.Tx, tokenHash, purpose string) (int, error) {
+	query := `UPDATE user_tokens SET used_at = now()
+			  WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+			  RETURNING user_id`
+
+	var userID int
+	err := tx.QueryRow(ctx, query, tokenHash, purpose).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, storages.ErrUserTokenInvalid
+	}
+	return userID, err
+}
+
+// GetUserByEmail получение пользователя по email, нужно для сброса пароля
+func (p *PSQL) GetUserByEmail(ctx context.Context, email string) (storages.User, error) {
+	var user storages.User
+
+	query := "SELECT id, username, email, wallet_id, role, email_verified_at IS NOT NULL FROM users WHERE email = $1"
+	err := p.pool.QueryRow(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.WalletUUID, &user.Role, &user.EmailVerified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.User{}, storages.ErrUserNotFound
+	}
+	return user, err
+}
+
+// CreateUserToken сохраняет токен из письма. Прежние неиспользованные токены того же назначения
+// перестают действовать: работает только ссылка из последнего письма
+func (p *PSQL) CreateUserToken(ctx context.Context, userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	const op = "postgres.CreateUserToken"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		query := `DELETE FROM user_tokens WHERE (user_id = $1 AND purpose = $2 AND used_at IS NULL) OR expires_at <= now()`
+		if _, err := tx.Exec(ctx, query, userID, purpose); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)`
+		_, err := tx.Exec(ctx, query, tokenHash, userID, purpose, expiresAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// VerifyEmail подтверждает email по токену из письма и возвращает id пользователя
+func (p *PSQL) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	const op = "postgres.VerifyEmail"
+
+	var userID int
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		userID, err = useUserToken(ctx, tx, tokenHash, storages.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1`, userID)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// ResetPassword меняет пароль по токену из письма и отзывает все сессии пользователя.
+// Письмо дошло до владельца адреса, поэтому email заодно считается подтверждённым
+func (p *PSQL) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	const op = "postgres.ResetPassword"
+
+	var userID int
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		userID, err = useUserToken(ctx, tx, tokenHash, storages.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE users SET password = $2, email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, userID, passwordHash); err != nil {
+			return err
+		}
+
+		query = `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+		if _, err := tx.Exec(ctx, query, userID, storages.TokenPasswordReset); err != nil {
+			return err
+		}
+
+		return revokeUserSessions(ctx, tx, userID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
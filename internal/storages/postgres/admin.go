@@ -0,0 +1,271 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gw-currency-wallet/internal/requestid"
+	"gw-currency-wallet/internal/storages"
+	"strings"
+)
+
+// accountAdjustments системный счёт ручных корректировок
+const accountAdjustments = "system:adjustments"
+
+// execer общая часть pgxpool.Pool и pgx.Tx для записи в журнал аудита
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// insertAudit записывает действие в журнал аудита. Кошелёк задаётся UUID, идентификатор запроса берётся из контекста
+func insertAudit(ctx context.Context, e execer, entry storages.AuditEntry) error {
+	query := `INSERT INTO admin_audit_log (actor_id, action, target_user_id, target_wallet_id, reason, details, request_id)
+			  VALUES ($1, $2, $3, (SELECT id FROM wallets WHERE uuid = $4), $5, $6, $7)`
+
+	// Пустые детали хранятся как NULL, а не как JSON null
+	var details any
+	if len(entry.Details) > 0 {
+		details = entry.Details
+	}
+
+	_, err := e.Exec(ctx, query, entry.ActorID, entry.Action, nullInt(entry.TargetUserID), entry.TargetWalletUUID,
+		nullString(entry.Reason), details, nullString(requestid.FromContext(ctx)))
+	return err
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchUsers поиск пользователей по подстроке имени или email и по роли, в порядке регистрации
+func (p *PSQL) SearchUsers(ctx context.Context, filter storages.UserFilter) ([]storages.UserSummary, error) {
+	const op = "postgres.SearchUsers"
+
+	var (
+		conditions = []string{"TRUE"}
+		args       []any
+	)
+	addCondition := func(format string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.Query != "" {
+		addCondition("(u.username ILIKE $%[1]d OR u.email ILIKE $%[1]d)", "%"+escapeLike(filter.Query)+"%")
+	}
+	if filter.Role != "" {
+		addCondition("u.role = $%d", filter.Role)
+	}
+	if filter.AfterID > 0 {
+		addCondition("u.id > $%d", filter.AfterID)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`SELECT u.id, u.username, u.email, u.role, COALESCE(u.wallet_id, ''),
+								 COALESCE(w.frozen_at IS NOT NULL, false), u.created_at
+						  FROM users u
+						  LEFT JOIN wallets w ON w.uuid = u.wallet_id
+						  WHERE %s ORDER BY u.id LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.UserSummary, error) {
+		var u storages.UserSummary
+		err := row.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.WalletUUID, &u.WalletFrozen, &u.CreatedAt)
+		return u, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// SetUserRole меняет роль пользователя. Сессии пользователя отзываются, чтобы токены со старой ролью
+// перестали действовать сразу, а не по истечении срока
+func (p *PSQL) SetUserRole(ctx context.Context, userID int, role string, audit storages.AuditEntry) error {
+	const op = "postgres.SetUserRole"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, role)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return storages.ErrUserNotFound
+		}
+
+		if err := revokeUserSessions(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		return insertAudit(ctx, tx, audit)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetWalletFrozen замораживает или размораживает кошелёк. Повторная заморозка сохраняет время первой
+func (p *PSQL) SetWalletFrozen(ctx context.Context, walletUUID string, frozen bool, audit storages.AuditEntry) (storages.Wallet, error) {
+	const op = "postgres.SetWalletFrozen"
+
+	var wallet storages.Wallet
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		wallet, err = lockWallet(ctx, tx, walletUUID)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE wallets SET frozen_at = CASE WHEN $2 THEN COALESCE(frozen_at, now()) END WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, wallet.ID, frozen); err != nil {
+			return err
+		}
+		wallet.Frozen = frozen
+
+		return insertAudit(ctx, tx, audit)
+	})
+	if err != nil {
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+// AdjustWallet ручная корректировка баланса со счёта корректировок. Допускается и для замороженного кошелька,
+// списание больше остатка возвращает storages.ErrInsufficientFunds. Причина сохраняется в истории операций
+func (p *PSQL) AdjustWallet(ctx context.Context, walletUUID string, adjustment storages.Adjustment, audit storages.AuditEntry) (storages.Wallet, error) {
+	const op = "postgres.AdjustWallet"
+
+	amount := adjustment.Amount.Abs()
+	if err := checkedAmount(ctx, p.pool, adjustment.Currency, amount); err != nil {
+		return storages.Wallet{}, err
+	}
+
+	var wallet storages.Wallet
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockWallet(ctx, tx, walletUUID)
+		if err != nil {
+			return err
+		}
+
+		credit := adjustment.Amount.IsPositive()
+		if !credit && balanceOf(locked, adjustment.Currency).LessThan(amount) {
+			return storages.ErrInsufficientFunds
+		}
+
+		balance, err := adjustBalance(ctx, tx, locked.ID, adjustment.Currency, adjustment.Amount)
+		if err != nil {
+			return err
+		}
+		wallet = withBalance(locked, adjustment.Currency, balance)
+
+		t := storages.Transaction{
+			WalletID: wallet.ID,
+			Type:     storages.TransactionAdjustment,
+			Memo:     adjustment.Reason,
+		}
+		from, to := walletAccount(wallet.UUID), accountAdjustments
+		if credit {
+			t.ToCurrency = adjustment.Currency
+			t.ToAmount = nullDecimal(amount)
+			t.ToBalanceBefore = nullDecimal(balanceOf(locked, adjustment.Currency))
+			t.ToBalanceAfter = nullDecimal(balance)
+			from, to = to, from
+		} else {
+			t.FromCurrency = adjustment.Currency
+			t.FromAmount = nullDecimal(amount)
+			t.FromBalanceBefore = nullDecimal(balanceOf(locked, adjustment.Currency))
+			t.FromBalanceAfter = nullDecimal(balance)
+		}
+
+		transactionID, err := insertTransaction(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+		if err := postJournal(ctx, tx, movement(adjustment.Currency, amount, from, to, transactionID)...); err != nil {
+			return err
+		}
+
+		if audit.Details == nil {
+			audit.Details = make(map[string]any)
+		}
+		audit.Details["transaction_id"] = transactionID
+		return insertAudit(ctx, tx, audit)
+	})
+	if err != nil {
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+// RecordAudit записывает в журнал действие, не изменяющее данных (например, просмотр чужого кошелька)
+func (p *PSQL) RecordAudit(ctx context.Context, entry storages.AuditEntry) error {
+	const op = "postgres.RecordAudit"
+
+	if err := insertAudit(ctx, p.pool, entry); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListAuditLog записи журнала аудита от новых к старым
+func (p *PSQL) ListAuditLog(ctx context.Context, filter storages.AuditFilter) ([]storages.AuditEntry, error) {
+	const op = "postgres.ListAuditLog"
+
+	var (
+		conditions = []string{"TRUE"}
+		args       []any
+	)
+	addCondition := func(format string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.ActorID > 0 {
+		addCondition("l.actor_id = $%d", filter.ActorID)
+	}
+	if filter.TargetWalletUUID != "" {
+		addCondition("w.uuid = $%d", filter.TargetWalletUUID)
+	}
+	if filter.Action != "" {
+		addCondition("l.action = $%d", filter.Action)
+	}
+	if filter.AfterID > 0 {
+		addCondition("l.id < $%d", filter.AfterID)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`SELECT l.id, l.actor_id, l.action, COALESCE(l.target_user_id, 0), COALESCE(w.uuid, ''),
+								 COALESCE(l.reason, ''), l.details, COALESCE(l.request_id, ''), l.created_at
+						  FROM admin_audit_log l
+						  LEFT JOIN wallets w ON w.id = l.target_wallet_id
+						  WHERE %s ORDER BY l.id DESC LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.AuditEntry, error) {
+		var e storages.AuditEntry
+		err := row.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetUserID, &e.TargetWalletUUID,
+			&e.Reason, &e.Details, &e.RequestID, &e.CreatedAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
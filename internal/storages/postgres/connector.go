@@ -9,15 +9,24 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
-
+	"gw-currency-wallet/internal/config"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"time"
 )
 
+// migrationFile имя файла up-миграции golang-migrate: 000013_rate_limits.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.up\.sql$`)
+
 // PSQL представляет собой обертку для работы с PostgreSQL.
 type PSQL struct {
 	pool    *pgxpool.Pool
 	timeout time.Duration
 	logger  *zap.Logger
+	// migrationVersion номер последней миграции в каталоге, до которого должна быть обновлена схема
+	migrationVersion uint
 }
 
 func NewPSQL(logger *zap.Logger) *PSQL {
@@ -27,18 +36,37 @@ func NewPSQL(logger *zap.Logger) *PSQL {
 	}
 }
 
-// Start функция для инициализации БД
-func (p *PSQL) Start(ctx context.Context, url string, timeout time.Duration, migrationsPath string) error {
+// Start функция для инициализации БД: подключение с таймаутом cfg.ConnTimeout, настройка пула и миграции
+func (p *PSQL) Start(ctx context.Context, cfg config.PostgresConfig) error {
 	const op = "postgres.Start"
 
-	p.timeout = timeout
+	url, err := cfg.ConnectionURL()
+	if err != nil {
+		p.logger.Error("Ошибка формирования строки подключения к БД", zap.Error(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	migrationsPath := cfg.MigrationsPath
+
+	p.timeout = cfg.ConnTimeout
 
 	ctxTimeout, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
-	p.logger.Info("Подключаемся к базе данных", zap.String("url", url))
+	p.logger.Info("Подключаемся к базе данных", zap.String("url", safeURL(url)))
 
-	pool, err := pgxpool.New(ctxTimeout, url)
+	poolConfig, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		p.logger.Error("Ошибка разбора строки подключения к БД", zap.Error(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	// Запросы и ожидание соединения попадают в трассу запроса, контекст которого передан в хранилище
+	poolConfig.ConnConfig.Tracer = newQueryTracer()
+
+	pool, err := pgxpool.NewWithConfig(ctxTimeout, poolConfig)
 	if err != nil {
 		p.logger.Error("Ошибка подключения к БД", zap.Error(err))
 		return fmt.Errorf("%s: %w", op, err)
@@ -56,7 +84,12 @@ func (p *PSQL) Start(ctx context.Context, url string, timeout time.Duration, mig
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	p.logger.Info("Подключение и миграции успешно выполнены", zap.String("url", url))
+	if p.migrationVersion, err = latestMigration(migrationsPath); err != nil {
+		p.logger.Error("Не удалось определить версию миграций", zap.Error(err), zap.String("op", op))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.logger.Info("Подключение и миграции успешно выполнены", zap.String("url", safeURL(url)))
 	return nil
 }
 
@@ -79,6 +112,80 @@ func doMigrate(dbURL, migrationsPath string) error {
 	return nil
 }
 
+// safeURL строка подключения для логов: пароль заменён на xxxxx
+func safeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// latestMigration номер последней up-миграции в каталоге migrationsPath
+func latestMigration(migrationsPath string) (uint, error) {
+	const op = "postgres.latestMigration"
+
+	entries, err := os.ReadDir(migrationsPath)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var latest uint
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		v, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		latest = max(latest, uint(v))
+	}
+
+	if latest == 0 {
+		return 0, fmt.Errorf("%s: в каталоге %s нет миграций", op, migrationsPath)
+	}
+	return latest, nil
+}
+
+// Ping проверяет, что БД отвечает
+func (p *PSQL) Ping(ctx context.Context) error {
+	const op = "postgres.Ping"
+
+	if p.pool == nil {
+		return fmt.Errorf("%s: пул соединений не инициализирован", op)
+	}
+	if err := p.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// CheckMigrations проверяет, что схема БД обновлена до последней миграции из каталога и не осталась
+// в состоянии dirty после неудачной миграции. Версия больше ожидаемой тоже ошибка: схему обновила
+// более новая версия сервиса, и с этим кодом она может быть несовместима
+func (p *PSQL) CheckMigrations(ctx context.Context) error {
+	const op = "postgres.CheckMigrations"
+
+	var (
+		version int64
+		dirty   bool
+	)
+	err := p.pool.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if dirty {
+		return fmt.Errorf("%s: миграция %d завершилась с ошибкой (dirty)", op, version)
+	}
+	if uint(version) != p.migrationVersion {
+		return fmt.Errorf("%s: версия схемы %d, ожидается %d", op, version, p.migrationVersion)
+	}
+	return nil
+}
+
 // Stop закрывает пул соединений с базой данных.
 func (p *PSQL) Stop() {
 	const op = "postgres.Stop"
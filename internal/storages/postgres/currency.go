@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+)
+
+// ListCurrencies включённые валюты справочника
+func (p *PSQL) ListCurrencies(ctx context.Context) ([]storages.Currency, error) {
+	const op = "postgres.ListCurrencies"
+
+	rows, err := p.pool.Query(ctx, `SELECT code, scale, name, enabled FROM currencies WHERE enabled ORDER BY code`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	currencies, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.Currency, error) {
+		var c storages.Currency
+		err := row.Scan(&c.Code, &c.Scale, &c.Name, &c.Enabled)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return currencies, nil
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+// ReserveIdempotencyKey занимает ключ за владельцем. Если действующий ключ уже есть,
+// возвращает его запись и created == false. Истёкший ключ занимается заново
+func (p *PSQL) ReserveIdempotencyKey(ctx context.Context, owner, key, requestHash string, ttl time.Duration) (storages.IdempotencyRecord, bool, error) {
+	const op = "postgres.ReserveIdempotencyKey"
+
+	query := `INSERT INTO idempotency_keys (owner, key, request_hash, expires_at)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (owner, key) DO UPDATE
+				  SET request_hash  = EXCLUDED.request_hash,
+					  status_code   = NULL,
+					  content_type  = NULL,
+					  response_body = NULL,
+					  created_at    = now(),
+					  expires_at    = EXCLUDED.expires_at
+			  WHERE idempotency_keys.expires_at <= now()`
+
+	tag, err := p.pool.Exec(ctx, query, owner, key, requestHash, time.Now().Add(ttl))
+	if err != nil {
+		return storages.IdempotencyRecord{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 1 {
+		return storages.IdempotencyRecord{RequestHash: requestHash}, true, nil
+	}
+
+	var (
+		rec         storages.IdempotencyRecord
+		statusCode  *int
+		contentType *string
+	)
+	query = `SELECT request_hash, status_code, content_type, response_body FROM idempotency_keys WHERE owner = $1 AND key = $2`
+	err = p.pool.QueryRow(ctx, query, owner, key).Scan(&rec.RequestHash, &statusCode, &contentType, &rec.Body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Ключ освободили между вставкой и чтением - считаем, что запрос ещё выполняется
+		return rec, false, nil
+	}
+	if err != nil {
+		return storages.IdempotencyRecord{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if statusCode != nil {
+		rec.Completed = true
+		rec.StatusCode = *statusCode
+	}
+	if contentType != nil {
+		rec.ContentType = *contentType
+	}
+
+	return rec, false, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ, который будет возвращаться на повторы запроса
+func (p *PSQL) CompleteIdempotencyKey(ctx context.Context, owner, key string, statusCode int, contentType string, body []byte) error {
+	query := `UPDATE idempotency_keys SET status_code = $3, content_type = $4, response_body = $5 WHERE owner = $1 AND key = $2`
+	_, err := p.pool.Exec(ctx, query, owner, key, statusCode, contentType, body)
+	return err
+}
+
+// ReleaseIdempotencyKey удаляет ключ, чтобы запрос можно было повторить (например, после внутренней ошибки)
+func (p *PSQL) ReleaseIdempotencyKey(ctx context.Context, owner, key string) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE owner = $1 AND key = $2`, owner, key)
+	return err
+}
+
+// PurgeIdempotencyKeys удаляет истёкшие ключи. Повтор с таким ключом и так выполнился бы заново,
+// а без очистки таблица вместе с сохранёнными ответами росла бы бесконечно
+func (p *PSQL) PurgeIdempotencyKeys(ctx context.Context) error {
+	const op = "postgres.PurgeIdempotencyKeys"
+
+	if _, err := p.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at < now()`); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
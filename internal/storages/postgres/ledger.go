@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/storages"
+)
+
+// Системные счета главной книги
+const (
+	accountCashIn  = "system:cash_in"
+	accountCashOut = "system:cash_out"
+	accountFX      = "system:fx"
+)
+
+var errUnbalancedJournal = errors.New("ledger journal is not balanced")
+
+// walletAccount код счёта кошелька в главной книге
+func walletAccount(walletUUID string) string {
+	return "wallet:" + walletUUID
+}
+
+// ledgerEntry проводка по счёту: amount > 0 - кредит (увеличивает баланс кошелька), amount < 0 - дебет
+type ledgerEntry struct {
+	account       string
+	currency      string
+	amount        decimal.Decimal
+	transactionID int64
+}
+
+// movement пара проводок: дебет счёта from и кредит счёта to на одну и ту же сумму
+func movement(currency string, amount decimal.Decimal, from, to string, transactionID int64) []ledgerEntry {
+	return []ledgerEntry{
+		{account: from, currency: currency, amount: amount.Neg(), transactionID: transactionID},
+		{account: to, currency: currency, amount: amount, transactionID: transactionID},
+	}
+}
+
+// postJournal записывает проводки одним журналом. Сумма проводок по каждой валюте обязана быть нулевой
+func postJournal(ctx context.Context, tx pgx.Tx, entries ...ledgerEntry) error {
+	sums := make(map[string]decimal.Decimal)
+	for _, e := range entries {
+		sums[e.currency] = sums[e.currency].Add(e.amount)
+	}
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s %s", errUnbalancedJournal, currency, sum)
+		}
+	}
+
+	journalID := uuid.New()
+
+	query := `INSERT INTO ledger_entries (journal_id, transaction_id, account_id, currency, amount)
+			  SELECT $1::uuid, $2::bigint, id, $4::varchar, $5::numeric FROM ledger_accounts WHERE code = $3`
+
+	for _, e := range entries {
+		var transactionID *int64
+		if e.transactionID > 0 {
+			transactionID = &e.transactionID
+		}
+
+		tag, err := tx.Exec(ctx, query, journalID, transactionID, e.account, e.currency, e.amount)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != 1 {
+			return fmt.Errorf("ledger account %s not found", e.account)
+		}
+	}
+
+	return nil
+}
+
+// VerifyLedger сверяет главную книгу: сумма всех проводок по каждой валюте и по каждому журналу
+// равна нулю, а балансы кошельков совпадают с остатками их счетов
+func (p *PSQL) VerifyLedger(ctx context.Context) (storages.LedgerReport, error) {
+	const op = "postgres.VerifyLedger"
+
+	var report storages.LedgerReport
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT currency, SUM(amount) FROM ledger_entries GROUP BY currency ORDER BY currency`)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	report.Totals, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.LedgerTotal, error) {
+		var t storages.LedgerTotal
+		err := row.Scan(&t.Currency, &t.Sum)
+		return t, err
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `SELECT COUNT(*) FROM (SELECT 1 FROM ledger_entries GROUP BY journal_id, currency HAVING SUM(amount) <> 0) j`
+	if err := tx.QueryRow(ctx, query).Scan(&report.UnbalancedJournals); err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query = `WITH ledger AS (SELECT a.wallet_id, e.currency, SUM(e.amount) AS amount
+							 FROM ledger_entries e
+							 JOIN ledger_accounts a ON a.id = e.account_id
+							 WHERE a.wallet_id IS NOT NULL
+							 GROUP BY a.wallet_id, e.currency)
+			 SELECT w.uuid, COALESCE(p.currency, l.currency), COALESCE(p.amount, 0), COALESCE(l.amount, 0)
+			 FROM wallet_balances p
+			 FULL JOIN ledger l ON l.wallet_id = p.wallet_id AND l.currency = p.currency
+			 JOIN wallets w ON w.id = COALESCE(p.wallet_id, l.wallet_id)
+			 WHERE COALESCE(p.amount, 0) <> COALESCE(l.amount, 0)
+			 ORDER BY w.id`
+
+	rows, err = tx.Query(ctx, query)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+	report.Mismatches, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.BalanceMismatch, error) {
+		var m storages.BalanceMismatch
+		err := row.Scan(&m.WalletUUID, &m.Currency, &m.Balance, &m.Ledger)
+		return m, err
+	})
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// RebuildBalances пересчитывает балансы всех кошельков по главной книге.
+// На время пересчёта изменения кошельков блокируются
+func (p *PSQL) RebuildBalances(ctx context.Context) error {
+	const op = "postgres.RebuildBalances"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `LOCK TABLE wallets IN EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM wallet_balances`); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO wallet_balances (wallet_id, currency, amount)
+				  SELECT a.wallet_id, e.currency, SUM(e.amount)
+				  FROM ledger_entries e
+				  JOIN ledger_accounts a ON a.id = e.account_id
+				  WHERE a.wallet_id IS NOT NULL
+				  GROUP BY a.wallet_id, e.currency
+				  HAVING SUM(e.amount) <> 0`
+
+		tag, err := tx.Exec(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		p.logger.Info("Балансы пересчитаны по главной книге", zap.Int64("balances", tag.RowsAffected()), zap.String("op", op))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -6,147 +6,106 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"go.uber.org/zap"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gw-currency-wallet/internal/storages"
 )
 
-// RegisterUser регистрация нового пользователя
-func (p *PSQL) RegisterUser(ctx context.Context, user storages.User) error {
+// uniqueViolation код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+// RegisterUser регистрация нового пользователя, в БД сохраняется только хеш пароля. Возвращает id пользователя.
+// Кошелёк создаётся в той же транзакции; занятое имя или email - storages.ErrUserExists
+func (p *PSQL) RegisterUser(ctx context.Context, user storages.User) (int, error) {
+	const op = "postgres.RegisterUser"
+
 	UUID, _ := uuid.NewUUID()
 
-	wallet := storages.Wallet{UUID: UUID.String()}
+	var id int
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		if err := createWallet(ctx, tx, UUID.String()); err != nil {
+			return err
+		}
 
-	if err := p.CreateWallet(ctx, wallet); err != nil {
-		return err
+		query := "INSERT INTO users (username, password, email, wallet_id) VALUES ($1, $2, $3, $4) RETURNING id"
+		return tx.QueryRow(ctx, query, user.Username, user.PasswordHash, user.Email, UUID.String()).Scan(&id)
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.TableName == "users" {
+		return 0, storages.ErrUserExists
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	query := "INSERT INTO users (username, password, email, wallet_id) VALUES ($1, $2, $3, $4)"
-	_, err := p.pool.Exec(ctx, query, user.Username, user.Password, user.Email, UUID.String())
-	return err
+	return id, nil
 }
 
-//func (p *PSQL) GetUser(ctx context.Context, username string) (storages.User, error) {
-//	var user storages.User
-//	query := "SELECT id, username, password, email FROM users WHERE username = $1"
-//	err := p.pool.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Email)
-//	return user, err
-//}
+// GetUserByUsername получение пользователя вместе с хешем пароля, необходимо для авторизации
+func (p *PSQL) GetUserByUsername(ctx context.Context, username string) (storages.User, error) {
+	var user storages.User
 
-// CreateWallet создание нового кошелька, вызывается при создании пользователя
-func (p *PSQL) CreateWallet(ctx context.Context, wallet storages.Wallet) error {
-	if p.pool == nil {
-		return errors.New("database pool is not initialized")
+	query := "SELECT id, username, password, email, wallet_id, role, email_verified_at IS NOT NULL FROM users WHERE username = $1"
+	err := p.pool.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.WalletUUID,
+		&user.Role, &user.EmailVerified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.User{}, storages.ErrUserNotFound
 	}
-	query := "INSERT INTO wallets (uuid, balanceRUB, balanceUSD, balanceEUR) VALUES ($1, $2, $3, $4)"
-	_, err := p.pool.Exec(ctx, query, wallet.UUID, 0, 0, 0)
-	return err
+	return user, err
 }
 
-// GetWalletByUsername получение кошелька по имени, необходимо для получения баланса, депозита, снятия и обмена
-func (p *PSQL) GetWalletByUsername(ctx context.Context, username string) (storages.Wallet, error) {
-	var wallet storages.Wallet
-
-	query := `SELECT w.id, w.uuid, w.balanceRUB, w.balanceUSD, w.balanceEUR 
-			  FROM wallets w
-			  JOIN users u ON w.uuid = u.wallet_id
-		      WHERE u.username = $1`
-	err := p.pool.QueryRow(ctx, query, username).Scan(&wallet.ID, &wallet.UUID, &wallet.Balance.RUB, &wallet.Balance.USD, &wallet.Balance.EUR)
-	return wallet, err
-}
-
-// GetBalance узнать баланс в рублях, долларах, евро
-func (p *PSQL) GetBalance(ctx context.Context, user storages.User) (storages.Wallet, error) {
-	var wallet storages.Wallet
-
-	p.logger.Info("Getting balance for user", zap.String("username", user.Username))
+// GetUserByID получение пользователя по id из access-токена
+func (p *PSQL) GetUserByID(ctx context.Context, userID int) (storages.User, error) {
+	var user storages.User
 
-	if user.Username == "" {
-		p.logger.Error("Username is empty")
-		return storages.Wallet{}, fmt.Errorf("username is required")
+	query := "SELECT id, username, email, wallet_id, role, email_verified_at IS NOT NULL FROM users WHERE id = $1"
+	err := p.pool.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.WalletUUID, &user.Role, &user.EmailVerified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.User{}, storages.ErrUserNotFound
 	}
+	return user, err
+}
 
-	query := `
-        SELECT wallets.id, wallets.uuid, wallets.balanceRUB, wallets.balanceUSD, wallets.balanceEUR
-        FROM wallets
-        JOIN users ON wallets.uuid = users.wallet_id
-        WHERE users.username = $1
-    `
-
-	err := p.pool.QueryRow(ctx, query, user.Username).Scan(
-		&wallet.ID,
-		&wallet.UUID,
-		&wallet.Balance.RUB,
-		&wallet.Balance.USD,
-		&wallet.Balance.EUR,
-	)
+// UpdateUserPassword замена хеша пароля, используется при перехешировании с новыми параметрами
+func (p *PSQL) UpdateUserPassword(ctx context.Context, userID int, passwordHash string) error {
+	query := "UPDATE users SET password = $1 WHERE id = $2"
+	tag, err := p.pool.Exec(ctx, query, passwordHash, userID)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			p.logger.Info("User wallet not found", zap.String("username", user.Username))
-			return storages.Wallet{}, fmt.Errorf("wallet not found for user: %s", user.Username)
-		}
-		if errors.Is(err, context.Canceled) {
-			p.logger.Warn("Request canceled", zap.String("username", user.Username))
-			return storages.Wallet{}, fmt.Errorf("request canceled")
-		}
-		p.logger.Error("Failed to get balance", zap.Error(err), zap.String("username", user.Username))
-		return storages.Wallet{}, fmt.Errorf("failed to get balance: %w", err)
+		return err
 	}
-
-	p.logger.Info("Successfully got balance", zap.String("username", user.Username), zap.Any("wallet", wallet))
-
-	return wallet, nil
+	if tag.RowsAffected() == 0 {
+		return storages.ErrUserNotFound
+	}
+	return nil
 }
 
-// Deposit пополнение счёта
-func (p *PSQL) Deposit(ctx context.Context, wallet storages.Wallet, currency string, amount float64) error {
-	query := ""
-	switch currency {
-	case "RUB":
-		query = `UPDATE wallets SET balanceRUB = balanceRUB + $1 WHERE uuid = $2`
-	case "USD":
-		query = `UPDATE wallets SET balanceUSD = balanceUSD + $1 WHERE uuid = $2`
-	case "EUR":
-		query = `UPDATE wallets SET balanceEUR = balanceEUR + $1 WHERE uuid = $2`
-	default:
-		return errors.New("unsupported currency")
-	}
-	_, err := p.pool.Exec(ctx, query, amount, wallet.UUID)
-	if err != nil {
-		return err
+// CreateWallet создание нового кошелька и его счёта в главной книге, вызывается при создании пользователя
+func (p *PSQL) CreateWallet(ctx context.Context, wallet storages.Wallet) error {
+	if p.pool == nil {
+		return errors.New("database pool is not initialized")
 	}
+	return createWallet(ctx, p.pool, wallet.UUID)
+}
+
+func createWallet(ctx context.Context, e execer, walletUUID string) error {
+	query := `WITH w AS (INSERT INTO wallets (uuid) VALUES ($1) RETURNING id, uuid)
+			  INSERT INTO ledger_accounts (code, wallet_id) SELECT $2, id FROM w`
+	_, err := e.Exec(ctx, query, walletUUID, walletAccount(walletUUID))
 	return err
 }
 
-// Withdraw снятие со счёта
-func (p *PSQL) Withdraw(ctx context.Context, wallet storages.Wallet, currency string, amount float64) error {
-	query := ""
-	switch currency {
-	case "RUB":
-		query = `UPDATE wallets SET balanceRUB = balanceRUB - $1 WHERE uuid = $2`
-	case "USD":
-		query = `UPDATE wallets SET balanceUSD = balanceUSD - $1 WHERE uuid = $2`
-	case "EUR":
-		query = `UPDATE wallets SET balanceEUR = balanceEUR - $1 WHERE uuid = $2`
-	default:
-		return errors.New("unsupported currency")
+// GetWallet кошелёк с балансами во всех валютах справочника
+func (p *PSQL) GetWallet(ctx context.Context, walletUUID string) (storages.Wallet, error) {
+	const op = "postgres.GetWallet"
+
+	query := fmt.Sprintf(`SELECT %s FROM wallets WHERE uuid = $1`, walletColumns)
+
+	wallet, err := scanWallet(ctx, p.pool, p.pool.QueryRow(ctx, query, walletUUID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, storages.ErrWalletNotFound)
 	}
-	_, err := p.pool.Exec(ctx, query, amount, wallet.UUID)
 	if err != nil {
-		return err
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, err)
 	}
-	return err
-}
 
-// UpdateWalletBalance обновление счёта, необходимо для обновления после обмена валюты
-func (p *PSQL) UpdateWalletBalance(ctx context.Context, wallet storages.Wallet) error {
-	query := `
-        UPDATE wallets
-        SET balanceRUB = $1,
-            balanceUSD = $2,
-            balanceEUR = $3
-        WHERE uuid = $4
-    `
-
-	_, err := p.pool.Exec(ctx, query, wallet.Balance.RUB, wallet.Balance.USD, wallet.Balance.EUR, wallet.UUID)
-	return err
+	return wallet, nil
 }
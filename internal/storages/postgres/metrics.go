@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gw-currency-wallet/internal/storages"
+)
+
+// BalanceTotals суммы балансов кошельков по всем валютам справочника, включая валюты без средств
+func (p *PSQL) BalanceTotals(ctx context.Context) ([]storages.BalanceTotal, error) {
+	const op = "postgres.BalanceTotals"
+
+	rows, err := p.pool.Query(ctx, `
+		SELECT c.code, COALESCE(SUM(b.amount), 0), COUNT(b.wallet_id) FILTER (WHERE b.amount > 0)
+		FROM currencies c
+		LEFT JOIN wallet_balances b ON b.currency = c.code
+		GROUP BY c.code
+		ORDER BY c.code`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	totals, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.BalanceTotal, error) {
+		var t storages.BalanceTotal
+		err := row.Scan(&t.Currency, &t.Amount, &t.Wallets)
+		return t, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return totals, nil
+}
+
+// PoolStat статистика пула соединений. До Start возвращает nil
+func (p *PSQL) PoolStat() *pgxpool.Stat {
+	if p.pool == nil {
+		return nil
+	}
+	return p.pool.Stat()
+}
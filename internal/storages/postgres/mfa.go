@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+// maxMFAChallengeAttempts число неверных кодов, после которого токен второго шага входа перестаёт действовать
+const maxMFAChallengeAttempts = 5
+
+// GetTOTP второй фактор пользователя, storages.ErrMFANotEnrolled, если он не настраивался
+func (p *PSQL) GetTOTP(ctx context.Context, userID int) (storages.TOTP, error) {
+	const op = "postgres.GetTOTP"
+
+	var totp storages.TOTP
+	query := `SELECT secret, confirmed_at IS NOT NULL, last_step FROM user_totp WHERE user_id = $1`
+	err := p.pool.QueryRow(ctx, query, userID).Scan(&totp.Secret, &totp.Confirmed, &totp.LastStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.TOTP{}, fmt.Errorf("%s: %w", op, storages.ErrMFANotEnrolled)
+	}
+	if err != nil {
+		return storages.TOTP{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return totp, nil
+}
+
+// EnrollTOTP сохраняет новый неподтверждённый секрет. Неподтверждённый секрет заменяется,
+// подтверждённый - нет: storages.ErrMFAAlreadyEnabled
+func (p *PSQL) EnrollTOTP(ctx context.Context, userID int, secret string) error {
+	const op = "postgres.EnrollTOTP"
+
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = now()
+			  WHERE user_totp.confirmed_at IS NULL`
+
+	tag, err := p.pool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storages.ErrMFAAlreadyEnabled)
+	}
+
+	return nil
+}
+
+// ConfirmTOTP включает второй фактор по первому принятому коду и заменяет коды восстановления
+func (p *PSQL) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryHashes []string) error {
+	const op = "postgres.ConfirmTOTP"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		query := `UPDATE user_totp SET confirmed_at = now(), last_step = $2
+				  WHERE user_id = $1 AND confirmed_at IS NULL AND last_step < $2`
+		tag, err := tx.Exec(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return storages.ErrTOTPInvalid
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::varchar[])`, userID, recoveryHashes)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep запоминает шаг принятого кода. Если код этого или более позднего шага уже принят
+// (например, параллельным запросом), возвращает storages.ErrTOTPInvalid
+func (p *PSQL) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	const op = "postgres.UseTOTPStep"
+
+	query := `UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2`
+	tag, err := p.pool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storages.ErrTOTPInvalid)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode гасит код восстановления, неизвестный или использованный код - storages.ErrTOTPInvalid
+func (p *PSQL) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	const op = "postgres.UseRecoveryCode"
+
+	query := `UPDATE recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	tag, err := p.pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, storages.ErrTOTPInvalid)
+	}
+
+	return nil
+}
+
+// CreateMFAChallenge сохраняет токен второго шага входа. Заодно удаляются истёкшие токены
+func (p *PSQL) CreateMFAChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	const op = "postgres.CreateMFAChallenge"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at <= now()`); err != nil {
+			return err
+		}
+		query := `INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+		_, err := tx.Exec(ctx, query, tokenHash, userID, expiresAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetMFAChallenge id пользователя действующего токена второго шага. Использованный, истёкший
+// или исчерпавший попытки токен - storages.ErrMFAChallengeInvalid
+func (p *PSQL) GetMFAChallenge(ctx context.Context, tokenHash string) (int, error) {
+	const op = "postgres.GetMFAChallenge"
+
+	query := `SELECT user_id FROM mfa_challenges
+			  WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts < $2`
+
+	var userID int
+	err := p.pool.QueryRow(ctx, query, tokenHash, maxMFAChallengeAttempts).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%s: %w", op, storages.ErrMFAChallengeInvalid)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// FailMFAChallenge учитывает неверный код, предъявленный с токеном
+func (p *PSQL) FailMFAChallenge(ctx context.Context, tokenHash string) error {
+	const op = "postgres.FailMFAChallenge"
+
+	if _, err := p.pool.Exec(ctx, `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1`, tokenHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CompleteMFAChallenge гасит токен второго шага и возвращает пользователя для начала сессии.
+// Из параллельных запросов с одним токеном успешен только один
+func (p *PSQL) CompleteMFAChallenge(ctx context.Context, tokenHash string) (storages.User, error) {
+	const op = "postgres.CompleteMFAChallenge"
+
+	query := `UPDATE mfa_challenges c SET used_at = now()
+			  FROM users u
+			  WHERE c.token_hash = $1 AND u.id = c.user_id
+				AND c.used_at IS NULL AND c.expires_at > now() AND c.attempts < $2
+			  RETURNING u.id, u.username, u.email, u.wallet_id, u.role, u.email_verified_at IS NOT NULL`
+
+	var user storages.User
+	err := p.pool.QueryRow(ctx, query, tokenHash, maxMFAChallengeAttempts).Scan(&user.ID, &user.Username, &user.Email,
+		&user.WalletUUID, &user.Role, &user.EmailVerified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.User{}, fmt.Errorf("%s: %w", op, storages.ErrMFAChallengeInvalid)
+	}
+	if err != nil {
+		return storages.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
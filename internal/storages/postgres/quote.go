@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+const quoteColumns = "id, from_currency, to_currency, rate, from_amount, to_amount, expires_at"
+
+func scanQuote(row pgx.Row) (storages.Quote, error) {
+	var q storages.Quote
+	err := row.Scan(&q.ID, &q.FromCurrency, &q.ToCurrency, &q.Rate, &q.FromAmount, &q.ToAmount, &q.ExpiresAt)
+	return q, err
+}
+
+// CreateQuote фиксирует курс и суммы обмена для кошелька на время ttl.
+// Средства не резервируются: их достаточность проверяется при обмене
+func (p *PSQL) CreateQuote(ctx context.Context, walletUUID string, exchanger storages.Exchanger, rate decimal.Decimal, ttl time.Duration) (storages.Quote, error) {
+	const op = "postgres.CreateQuote"
+
+	converted, err := convertAmount(ctx, p.pool, exchanger, rate)
+	if err != nil {
+		return storages.Quote{}, err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO exchange_quotes (wallet_id, from_currency, to_currency, rate, from_amount, to_amount, expires_at)
+			  SELECT id, $2, $3, $4, $5, $6, now() + $7::interval FROM wallets WHERE uuid = $1
+			  RETURNING %s`, quoteColumns)
+
+	quote, err := scanQuote(p.pool.QueryRow(ctx, query, walletUUID, exchanger.FromCurrency, exchanger.ToCurrency,
+		rate, exchanger.Amount, converted, ttl))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.Quote{}, fmt.Errorf("%s: %w", op, storages.ErrWalletNotFound)
+	}
+	if err != nil {
+		return storages.Quote{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return quote, nil
+}
+
+// useQuote помечает котировку кошелька использованной. Условный UPDATE гарантирует,
+// что из двух параллельных обменов по одной котировке пройдёт только один
+func useQuote(ctx context.Context, tx pgx.Tx, walletID int, quoteID string) (storages.Quote, error) {
+	query := fmt.Sprintf(`UPDATE exchange_quotes SET used_at = now()
+			  WHERE id = $1 AND wallet_id = $2 AND used_at IS NULL AND expires_at > now()
+			  RETURNING %s`, quoteColumns)
+
+	quote, err := scanQuote(tx.QueryRow(ctx, query, quoteID, walletID))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return quote, err
+	}
+
+	// Котировка не подошла - выясняем почему
+	var used bool
+	err = tx.QueryRow(ctx, `SELECT used_at IS NOT NULL FROM exchange_quotes WHERE id = $1 AND wallet_id = $2`,
+		quoteID, walletID).Scan(&used)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return storages.Quote{}, storages.ErrQuoteNotFound
+	case err != nil:
+		return storages.Quote{}, err
+	case used:
+		return storages.Quote{}, storages.ErrQuoteUsed
+	default:
+		return storages.Quote{}, storages.ErrQuoteExpired
+	}
+}
+
+// ExchangeByQuote обмен точно по курсу и суммам котировки. Котировка помечается использованной
+// в той же транзакции, поэтому при ошибке обмена (например, нехватке средств) ею можно воспользоваться снова
+func (p *PSQL) ExchangeByQuote(ctx context.Context, walletUUID string, quoteID string) (storages.Wallet, storages.Quote, error) {
+	const op = "postgres.ExchangeByQuote"
+
+	var (
+		wallet storages.Wallet
+		quote  storages.Quote
+	)
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockActiveWallet(ctx, tx, walletUUID)
+		if err != nil {
+			return err
+		}
+
+		quote, err = useQuote(ctx, tx, locked.ID, quoteID)
+		if err != nil {
+			return err
+		}
+
+		exchanger := storages.Exchanger{
+			FromCurrency: quote.FromCurrency,
+			ToCurrency:   quote.ToCurrency,
+			Amount:       quote.FromAmount,
+		}
+		var transactionID int64
+		wallet, transactionID, err = exchangeLocked(ctx, tx, locked, exchanger, quote.ToAmount, quote.Rate)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE exchange_quotes SET transaction_id = $1 WHERE id = $2`, transactionID, quote.ID)
+		return err
+	})
+	if err != nil {
+		return storages.Wallet{}, storages.Quote{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, quote, nil
+}
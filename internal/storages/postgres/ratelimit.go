@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+// TakeRateLimitToken берёт токен из корзины key вместимостью burst, которая пополняется на один токен за interval.
+// Строка корзины блокируется на время расчёта, поэтому экземпляры сервиса не берут один и тот же токен дважды
+func (p *PSQL) TakeRateLimitToken(ctx context.Context, key string, burst int, interval time.Duration) (storages.RateLimitResult, error) {
+	const op = "postgres.TakeRateLimitToken"
+
+	var res storages.RateLimitResult
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		// Новая корзина сначала создаётся полной: иначе двум первым запросам нечего блокировать,
+		// и второй перезапишет корзину первого, вернув взятый им токен
+		now := time.Now()
+		query := `INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING`
+		if _, err := tx.Exec(ctx, query, key, float64(burst), now); err != nil {
+			return err
+		}
+
+		var bucket storages.TokenBucket
+		err := tx.QueryRow(ctx, `SELECT tokens, updated_at FROM rate_limits WHERE key = $1 FOR UPDATE`, key).
+			Scan(&bucket.Tokens, &bucket.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		// Время берётся после блокировки строки: параллельный запрос мог обновить корзину, пока этот ждал
+		bucket, res = bucket.Take(time.Now(), burst, interval)
+
+		_, err = tx.Exec(ctx, `UPDATE rate_limits SET tokens = $2, updated_at = $3 WHERE key = $1`, key, bucket.Tokens, bucket.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return storages.RateLimitResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return res, nil
+}
+
+// PurgeRateLimits удаляет корзины, к которым не обращались дольше olderThan: они давно полные.
+// Неудачные попытки входа удаляются, когда и последняя неудача, и блокировка старше loginWindow:
+// счёт по ним всё равно начался бы заново. Иначе попытки под выдуманными именами копились бы без конца
+func (p *PSQL) PurgeRateLimits(ctx context.Context, olderThan, loginWindow time.Duration) error {
+	const op = "postgres.PurgeRateLimits"
+
+	now := time.Now()
+	if _, err := p.pool.Exec(ctx, `DELETE FROM rate_limits WHERE updated_at < $1`, now.Add(-olderThan)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `DELETE FROM login_failures WHERE last_failed_at < $1 AND (blocked_until IS NULL OR blocked_until < $1)`
+	if _, err := p.pool.Exec(ctx, query, now.Add(-loginWindow)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RecordLoginAttempt учитывает попытку входа по ключу одним запросом: если вход не отложен, счётчик неудач
+// увеличивается и сразу назначается задержка следующей попытки delays[failures-1] (последняя - для всех
+// следующих неудач). Если прошлая неудача была раньше чем window назад, счёт начинается заново.
+// Отложенная попытка не учитывается и возвращается с allowed == false
+func (p *PSQL) RecordLoginAttempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (storages.LoginAttempts, bool, error) {
+	const op = "postgres.RecordLoginAttempt"
+
+	micros := make([]int64, len(delays))
+	for i, d := range delays {
+		micros[i] = d.Microseconds()
+	}
+
+	// Строка блокируется на время INSERT ... ON CONFLICT, поэтому параллельные попытки получают разные номера.
+	// Если вход отложен, условие WHERE не выполняется и attempt пуст - тогда возвращается текущая блокировка
+	now := time.Now()
+	query := `WITH attempt AS (
+				  INSERT INTO login_failures AS f (key, failures, last_failed_at, blocked_until)
+				  VALUES ($1, 1, $2::timestamptz, $2::timestamptz + ($4::bigint[])[1]::float8 * interval '1 microsecond')
+				  ON CONFLICT (key) DO UPDATE
+				  SET failures = CASE WHEN f.last_failed_at < $3::timestamptz THEN 1 ELSE f.failures + 1 END,
+				      last_failed_at = EXCLUDED.last_failed_at,
+				      blocked_until = $2::timestamptz + ($4::bigint[])[LEAST(
+				          CASE WHEN f.last_failed_at < $3::timestamptz THEN 1 ELSE f.failures + 1 END,
+				          cardinality($4::bigint[]))]::float8 * interval '1 microsecond'
+				  WHERE f.blocked_until IS NULL OR f.blocked_until <= $2::timestamptz
+				  RETURNING failures, last_failed_at, blocked_until
+			  )
+			  SELECT true, failures, last_failed_at, blocked_until FROM attempt
+			  UNION ALL
+			  SELECT false, failures, last_failed_at, blocked_until FROM login_failures
+			  WHERE key = $1 AND NOT EXISTS (SELECT 1 FROM attempt)`
+
+	var (
+		attempts     storages.LoginAttempts
+		allowed      bool
+		blockedUntil *time.Time
+	)
+	err := p.pool.QueryRow(ctx, query, key, now, now.Add(-window), micros).
+		Scan(&allowed, &attempts.Failures, &attempts.LastFailedAt, &blockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Строку создала параллельная попытка уже после начала запроса, и вход по ней отложен
+		return storages.LoginAttempts{}, false, nil
+	}
+	if err != nil {
+		return storages.LoginAttempts{}, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if blockedUntil != nil {
+		attempts.BlockedUntil = *blockedUntil
+	}
+
+	return attempts, allowed, nil
+}
+
+// ResetLoginFailures сбрасывает счётчик после успешного входа
+func (p *PSQL) ResetLoginFailures(ctx context.Context, key string) error {
+	const op = "postgres.ResetLoginFailures"
+
+	if _, err := p.pool.Exec(ctx, `DELETE FROM login_failures WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+	"time"
+)
+
+const sessionColumns = "id, user_agent, ip, created_at, last_used_at, expires_at"
+
+func scanSession(row pgx.Row) (storages.Session, error) {
+	var s storages.Session
+	err := row.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt)
+	return s, err
+}
+
+func insertRefreshToken(ctx context.Context, tx pgx.Tx, sessionID string, refresh storages.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (token_hash, session_id, access_jti, access_expires_at, expires_at)
+			  VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.Exec(ctx, query, refresh.Hash, sessionID, refresh.AccessJTI, refresh.AccessExpiresAt, refresh.ExpiresAt)
+	return err
+}
+
+// revokeSession отзывает семейство refresh-токенов и ещё действующие access-токены, выданные в сессии
+func revokeSession(ctx context.Context, tx pgx.Tx, sessionID string) error {
+	if _, err := tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, sessionID); err != nil {
+		return err
+	}
+
+	// Заодно чистим записи об уже истёкших access-токенах: проверять их больше не нужно
+	if _, err := tx.Exec(ctx, `DELETE FROM revoked_access_tokens WHERE expires_at <= now()`); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO revoked_access_tokens (jti, expires_at)
+			  SELECT access_jti, access_expires_at FROM refresh_tokens
+			  WHERE session_id = $1 AND access_expires_at > now()
+			  ON CONFLICT (jti) DO NOTHING`
+	_, err := tx.Exec(ctx, query, sessionID)
+	return err
+}
+
+// revokeUserSessions отзывает все действующие сессии пользователя
+func revokeUserSessions(ctx context.Context, tx pgx.Tx, userID int) error {
+	rows, err := tx.Query(ctx, `SELECT id FROM sessions WHERE user_id = $1 AND revoked_at IS NULL FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+	sessionIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sessionIDs {
+		if err := revokeSession(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSession начинает сессию пользователя с первым refresh-токеном
+func (p *PSQL) CreateSession(ctx context.Context, session storages.Session, refresh storages.RefreshToken) error {
+	const op = "postgres.CreateSession"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		query := `INSERT INTO sessions (id, user_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4, $5)`
+		if _, err := tx.Exec(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP, refresh.ExpiresAt); err != nil {
+			return err
+		}
+		return insertRefreshToken(ctx, tx, session.ID, refresh)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken меняет refresh-токен на next в той же сессии. Предъявление уже использованного токена
+// означает его утечку: сессия отзывается целиком и возвращается storages.ErrRefreshTokenReused
+func (p *PSQL) RotateRefreshToken(ctx context.Context, refreshHash string, next storages.RefreshToken) (storages.User, storages.Session, error) {
+	const op = "postgres.RotateRefreshToken"
+
+	var (
+		user    storages.User
+		session storages.Session
+		reused  bool
+	)
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var (
+			sessionID string
+			expiresAt time.Time
+			used      bool
+			revoked   bool
+		)
+		query := `SELECT rt.session_id, rt.expires_at, rt.used_at IS NOT NULL, s.revoked_at IS NOT NULL,
+						 u.id, u.username, u.email, u.wallet_id, u.role,
+						 u.email_verified_at IS NOT NULL
+				  FROM refresh_tokens rt
+				  JOIN sessions s ON s.id = rt.session_id
+				  JOIN users u ON u.id = s.user_id
+				  WHERE rt.token_hash = $1
+				  FOR UPDATE OF rt, s`
+		err := tx.QueryRow(ctx, query, refreshHash).Scan(&sessionID, &expiresAt, &used, &revoked,
+			&user.ID, &user.Username, &user.Email, &user.WalletUUID, &user.Role, &user.EmailVerified)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storages.ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case revoked:
+			return storages.ErrRefreshTokenInvalid
+		case used:
+			// Отзыв сессии должен сохраниться, поэтому транзакция завершается без ошибки
+			reused = true
+			return revokeSession(ctx, tx, sessionID)
+		case !expiresAt.After(time.Now()):
+			return storages.ErrRefreshTokenInvalid
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE token_hash = $1`, refreshHash); err != nil {
+			return err
+		}
+		if err := insertRefreshToken(ctx, tx, sessionID, next); err != nil {
+			return err
+		}
+
+		query = fmt.Sprintf(`UPDATE sessions SET last_used_at = now(), expires_at = $2 WHERE id = $1 RETURNING %s`, sessionColumns)
+		session, err = scanSession(tx.QueryRow(ctx, query, sessionID, next.ExpiresAt))
+		return err
+	})
+	if err != nil {
+		return storages.User{}, storages.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if reused {
+		return storages.User{}, storages.Session{}, fmt.Errorf("%s: %w", op, storages.ErrRefreshTokenReused)
+	}
+
+	session.UserID = user.ID
+	return user, session, nil
+}
+
+// ListSessions действующие сессии пользователя, последние использованные первыми
+func (p *PSQL) ListSessions(ctx context.Context, userID int) ([]storages.Session, error) {
+	const op = "postgres.ListSessions"
+
+	query := fmt.Sprintf(`SELECT %s FROM sessions
+			  WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+			  ORDER BY last_used_at DESC`, sessionColumns)
+
+	rows, err := p.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.Session, error) {
+		return scanSession(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession отзывает сессию пользователя вместе с её access-токенами
+func (p *PSQL) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	const op = "postgres.RevokeSession"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		query := `SELECT id FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL FOR UPDATE`
+
+		var id string
+		err := tx.QueryRow(ctx, query, sessionID, userID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storages.ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return revokeSession(ctx, tx, id)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked сообщает, отозван ли access-токен с идентификатором jti
+func (p *PSQL) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := p.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	return revoked, err
+}
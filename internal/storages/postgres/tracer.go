@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gw-currency-wallet/internal/tracing"
+	"strings"
+)
+
+// queryTracer открывает спаны OpenTelemetry на запросы к БД и ожидание соединения из пула.
+// Спаны создаются только внутри уже начатой трассы: фоновые задачи без запроса не плодят одиночных трасс.
+// Аргументы запросов в спан не пишутся - среди них хеши паролей и токенов
+type queryTracer struct {
+	tracer trace.Tracer
+}
+
+// tracerSpanKey ключ контекста для спана, открытого трассировщиком: End закрывает только его, а не чужой спан
+type tracerSpanKey struct{}
+
+func newQueryTracer() *queryTracer {
+	return &queryTracer{tracer: tracing.Tracer()}
+}
+
+func (t *queryTracer) start(ctx context.Context, name string, opts ...trace.SpanStartOption) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	opts = append(opts, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(semconv.DBSystemPostgreSQL))
+	ctx, span := t.tracer.Start(ctx, name, opts...)
+	return context.WithValue(ctx, tracerSpanKey{}, span)
+}
+
+func (t *queryTracer) end(ctx context.Context, err error) {
+	span, ok := ctx.Value(tracerSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := sqlOperation(data.SQL)
+	return t.start(ctx, "postgres "+operation, trace.WithAttributes(
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(data.SQL),
+	))
+}
+
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	if span, ok := ctx.Value(tracerSpanKey{}).(trace.Span); ok && data.Err == nil {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	t.end(ctx, data.Err)
+}
+
+func (t *queryTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return t.start(ctx, "postgres acquire")
+}
+
+func (t *queryTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	t.end(ctx, data.Err)
+}
+
+// sqlOperation первое слово запроса (SELECT, INSERT, WITH...) для имени спана
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"gw-currency-wallet/internal/requestid"
+	"gw-currency-wallet/internal/storages"
+	"strings"
+)
+
+const transactionColumns = `t.id, t.wallet_id, t.type,
+	COALESCE(t.from_currency, ''), t.from_amount, t.from_balance_before, t.from_balance_after,
+	COALESCE(t.to_currency, ''), t.to_amount, t.to_balance_before, t.to_balance_after,
+	t.rate, COALESCE(cw.uuid, ''), COALESCE(t.memo, ''), COALESCE(t.request_id, ''), t.created_at`
+
+func nullDecimal(d decimal.Decimal) decimal.NullDecimal {
+	return decimal.NullDecimal{Decimal: d, Valid: true}
+}
+
+func nullInt(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// insertTransaction записывает операцию в историю в рамках транзакции, изменившей баланс,
+// и возвращает id записи. Идентификатор запроса берётся из контекста
+func insertTransaction(ctx context.Context, tx pgx.Tx, t storages.Transaction) (int64, error) {
+	query := `INSERT INTO transactions (wallet_id, type,
+				from_currency, from_amount, from_balance_before, from_balance_after,
+				to_currency, to_amount, to_balance_before, to_balance_after,
+				rate, counterparty_wallet_id, memo, request_id)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			  RETURNING id`
+
+	var id int64
+	err := tx.QueryRow(ctx, query, t.WalletID, t.Type,
+		nullString(t.FromCurrency), t.FromAmount, t.FromBalanceBefore, t.FromBalanceAfter,
+		nullString(t.ToCurrency), t.ToAmount, t.ToBalanceBefore, t.ToBalanceAfter,
+		t.Rate, nullInt(t.CounterpartyWalletID), nullString(t.Memo), nullString(requestid.FromContext(ctx)),
+	).Scan(&id)
+	return id, err
+}
+
+// ListTransactions история операций кошелька пользователя от новых к старым
+func (p *PSQL) ListTransactions(ctx context.Context, walletUUID string, filter storages.TransactionFilter) ([]storages.Transaction, error) {
+	const op = "postgres.ListTransactions"
+
+	conditions := []string{"t.wallet_id = (SELECT id FROM wallets WHERE uuid = $1)"}
+	args := []any{walletUUID}
+
+	addCondition := func(format string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.Type != "" {
+		addCondition("t.type = $%d", filter.Type)
+	}
+	if filter.Currency != "" {
+		addCondition("$%[1]d IN (t.from_currency, t.to_currency)", filter.Currency)
+	}
+	if !filter.Since.IsZero() {
+		addCondition("t.created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		addCondition("t.created_at < $%d", filter.Until)
+	}
+	if filter.AfterID > 0 {
+		addCondition("t.id < $%d", filter.AfterID)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`SELECT %s FROM transactions t LEFT JOIN wallets cw ON cw.id = t.counterparty_wallet_id
+						  WHERE %s ORDER BY t.id DESC LIMIT $%d`,
+		transactionColumns, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	transactions := make([]storages.Transaction, 0, filter.Limit)
+	for rows.Next() {
+		var t storages.Transaction
+		err := rows.Scan(&t.ID, &t.WalletID, &t.Type,
+			&t.FromCurrency, &t.FromAmount, &t.FromBalanceBefore, &t.FromBalanceAfter,
+			&t.ToCurrency, &t.ToAmount, &t.ToBalanceBefore, &t.ToBalanceAfter,
+			&t.Rate, &t.CounterpartyWalletUUID, &t.Memo, &t.RequestID, &t.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"gw-currency-wallet/internal/storages"
+)
+
+// findRecipientWalletID ищет кошелёк получателя по имени, email или UUID кошелька
+func findRecipientWalletID(ctx context.Context, tx pgx.Tx, transfer storages.Transfer) (int, error) {
+	var (
+		query string
+		arg   string
+	)
+
+	switch {
+	case transfer.ToUsername != "":
+		query, arg = `SELECT w.id FROM wallets w JOIN users u ON w.uuid = u.wallet_id WHERE u.username = $1`, transfer.ToUsername
+	case transfer.ToEmail != "":
+		query, arg = `SELECT w.id FROM wallets w JOIN users u ON w.uuid = u.wallet_id WHERE u.email = $1`, transfer.ToEmail
+	case transfer.ToWalletUUID != "":
+		query, arg = `SELECT id FROM wallets WHERE uuid = $1`, transfer.ToWalletUUID
+	default:
+		return 0, storages.ErrRecipientNotFound
+	}
+
+	var id int
+	err := tx.QueryRow(ctx, query, arg).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, storages.ErrRecipientNotFound
+	}
+	return id, err
+}
+
+// lockWalletsByID блокирует кошельки в порядке возрастания id, чтобы встречные переводы не взаимоблокировались
+func lockWalletsByID(ctx context.Context, tx pgx.Tx, ids ...int) (map[int]storages.Wallet, error) {
+	query := fmt.Sprintf(`SELECT %s FROM wallets WHERE id = ANY($1) ORDER BY id FOR UPDATE`, walletColumns)
+	rows, err := tx.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (storages.Wallet, error) {
+		var w storages.Wallet
+		err := row.Scan(&w.ID, &w.UUID, &w.Frozen)
+		return w, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[int]storages.Wallet, len(wallets))
+	for _, w := range wallets {
+		if w.Balance, err = loadBalances(ctx, tx, w.ID); err != nil {
+			return nil, err
+		}
+		locked[w.ID] = w
+	}
+	for _, id := range ids {
+		if _, ok := locked[id]; !ok {
+			return nil, storages.ErrWalletNotFound
+		}
+	}
+
+	return locked, nil
+}
+
+// Transfer перевод другому пользователю: списание и зачисление в одной транзакции.
+// Каждая сторона получает запись в истории, в главной книге - один журнал.
+// Возвращает кошелёк отправителя с новым балансом
+func (p *PSQL) Transfer(ctx context.Context, walletUUID string, transfer storages.Transfer) (storages.Wallet, error) {
+	const op = "postgres.Transfer"
+
+	if err := checkedAmount(ctx, p.pool, transfer.Currency, transfer.Amount); err != nil {
+		return storages.Wallet{}, err
+	}
+
+	var sender storages.Wallet
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var senderID int
+		err := tx.QueryRow(ctx, `SELECT id FROM wallets WHERE uuid = $1`, walletUUID).Scan(&senderID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storages.ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		recipientID, err := findRecipientWalletID(ctx, tx, transfer)
+		if err != nil {
+			return err
+		}
+		if recipientID == senderID {
+			return storages.ErrSelfTransfer
+		}
+
+		locked, err := lockWalletsByID(ctx, tx, senderID, recipientID)
+		if err != nil {
+			return err
+		}
+		// Замороженный кошелёк не может ни отправлять, ни получать переводы
+		if locked[senderID].Frozen || locked[recipientID].Frozen {
+			return storages.ErrWalletFrozen
+		}
+
+		if balanceOf(locked[senderID], transfer.Currency).LessThan(transfer.Amount) {
+			return storages.ErrInsufficientFunds
+		}
+
+		senderBalance, err := adjustBalance(ctx, tx, senderID, transfer.Currency, transfer.Amount.Neg())
+		if err != nil {
+			return err
+		}
+		sender = withBalance(locked[senderID], transfer.Currency, senderBalance)
+
+		recipientBalance, err := adjustBalance(ctx, tx, recipientID, transfer.Currency, transfer.Amount)
+		if err != nil {
+			return err
+		}
+		recipient := withBalance(locked[recipientID], transfer.Currency, recipientBalance)
+
+		outID, err := insertTransaction(ctx, tx, storages.Transaction{
+			WalletID:             sender.ID,
+			Type:                 storages.TransactionTransferOut,
+			FromCurrency:         transfer.Currency,
+			FromAmount:           nullDecimal(transfer.Amount),
+			FromBalanceBefore:    nullDecimal(balanceOf(locked[senderID], transfer.Currency)),
+			FromBalanceAfter:     nullDecimal(balanceOf(sender, transfer.Currency)),
+			CounterpartyWalletID: recipient.ID,
+			Memo:                 transfer.Memo,
+		})
+		if err != nil {
+			return err
+		}
+
+		inID, err := insertTransaction(ctx, tx, storages.Transaction{
+			WalletID:             recipient.ID,
+			Type:                 storages.TransactionTransferIn,
+			ToCurrency:           transfer.Currency,
+			ToAmount:             nullDecimal(transfer.Amount),
+			ToBalanceBefore:      nullDecimal(balanceOf(locked[recipientID], transfer.Currency)),
+			ToBalanceAfter:       nullDecimal(balanceOf(recipient, transfer.Currency)),
+			CounterpartyWalletID: sender.ID,
+			Memo:                 transfer.Memo,
+		})
+		if err != nil {
+			return err
+		}
+
+		return postJournal(ctx, tx,
+			ledgerEntry{account: walletAccount(sender.UUID), currency: transfer.Currency, amount: transfer.Amount.Neg(), transactionID: outID},
+			ledgerEntry{account: walletAccount(recipient.UUID), currency: transfer.Currency, amount: transfer.Amount, transactionID: inID},
+		)
+	})
+	if err != nil {
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sender, nil
+}
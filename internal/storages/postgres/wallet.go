@@ -0,0 +1,347 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"gw-currency-wallet/internal/money"
+	"gw-currency-wallet/internal/storages"
+)
+
+// querier общая часть pgxpool.Pool и pgx.Tx, нужная для чтения справочников и балансов
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// currencyScale количество знаков валюты из справочника. Неизвестная или отключённая валюта - storages.ErrUnsupportedCurrency
+func currencyScale(ctx context.Context, q querier, currency string) (int32, error) {
+	var scale int32
+	err := q.QueryRow(ctx, `SELECT scale FROM currencies WHERE code = $1 AND enabled`, currency).Scan(&scale)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, storages.ErrUnsupportedCurrency
+	}
+	return scale, err
+}
+
+// checkAmount проверяет, что сумма положительна и не точнее минимальной единицы валюты
+func checkAmount(amount decimal.Decimal, scale int32) error {
+	if !amount.IsPositive() {
+		return storages.ErrInvalidAmount
+	}
+	if !money.FitsScale(amount, scale) {
+		return storages.ErrAmountPrecision
+	}
+	return nil
+}
+
+// checkedAmount проверяет валюту по справочнику и сумму по её количеству знаков
+func checkedAmount(ctx context.Context, q querier, currency string, amount decimal.Decimal) error {
+	scale, err := currencyScale(ctx, q, currency)
+	if err != nil {
+		return err
+	}
+	return checkAmount(amount, scale)
+}
+
+func balanceOf(wallet storages.Wallet, currency string) decimal.Decimal {
+	return wallet.Balance[currency]
+}
+
+// withBalance копия кошелька с новым балансом в валюте, исходный кошелёк не меняется
+func withBalance(wallet storages.Wallet, currency string, amount decimal.Decimal) storages.Wallet {
+	balances := make(storages.Balances, len(wallet.Balance)+1)
+	for code, v := range wallet.Balance {
+		balances[code] = v
+	}
+	balances[currency] = amount
+	wallet.Balance = balances
+	return wallet
+}
+
+// loadBalances балансы кошелька по всем включённым валютам, а также по отключённым, если на них остались средства
+func loadBalances(ctx context.Context, q querier, walletID int) (storages.Balances, error) {
+	query := `SELECT c.code, COALESCE(b.amount, 0)
+			  FROM currencies c
+			  LEFT JOIN wallet_balances b ON b.currency = c.code AND b.wallet_id = $1
+			  WHERE c.enabled OR b.amount <> 0`
+
+	rows, err := q.Query(ctx, query, walletID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(storages.Balances)
+	for rows.Next() {
+		var (
+			code   string
+			amount decimal.Decimal
+		)
+		if err := rows.Scan(&code, &amount); err != nil {
+			return nil, err
+		}
+		balances[code] = amount
+	}
+	return balances, rows.Err()
+}
+
+// walletColumns столбцы кошелька в порядке, который ожидает scanWallet
+const walletColumns = "id, uuid, frozen_at IS NOT NULL"
+
+// scanWallet читает walletColumns из row и подгружает балансы кошелька
+func scanWallet(ctx context.Context, q querier, row pgx.Row) (storages.Wallet, error) {
+	var wallet storages.Wallet
+	if err := row.Scan(&wallet.ID, &wallet.UUID, &wallet.Frozen); err != nil {
+		return storages.Wallet{}, err
+	}
+
+	balances, err := loadBalances(ctx, q, wallet.ID)
+	if err != nil {
+		return storages.Wallet{}, err
+	}
+	wallet.Balance = balances
+	return wallet, nil
+}
+
+// adjustBalance изменяет баланс кошелька в валюте на delta и возвращает новое значение.
+// Вызывается только под блокировкой строки кошелька, достаточность средств проверяется до вызова
+func adjustBalance(ctx context.Context, tx pgx.Tx, walletID int, currency string, delta decimal.Decimal) (decimal.Decimal, error) {
+	query := `INSERT INTO wallet_balances (wallet_id, currency, amount) VALUES ($1, $2, $3)
+			  ON CONFLICT (wallet_id, currency) DO UPDATE SET amount = wallet_balances.amount + EXCLUDED.amount
+			  RETURNING amount`
+
+	var amount decimal.Decimal
+	err := tx.QueryRow(ctx, query, walletID, currency, delta).Scan(&amount)
+	return amount, err
+}
+
+// inTx выполняет fn в транзакции: коммит при успехе, откат при ошибке
+func (p *PSQL) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockWallet читает кошелёк и блокирует строку до конца транзакции.
+// Все изменения балансов кошелька выполняются под этой блокировкой
+func lockWallet(ctx context.Context, tx pgx.Tx, walletUUID string) (storages.Wallet, error) {
+	query := fmt.Sprintf(`SELECT %s FROM wallets WHERE uuid = $1 FOR UPDATE`, walletColumns)
+
+	wallet, err := scanWallet(ctx, tx, tx.QueryRow(ctx, query, walletUUID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storages.Wallet{}, storages.ErrWalletNotFound
+	}
+	return wallet, err
+}
+
+// lockActiveWallet как lockWallet, но для замороженного кошелька возвращает storages.ErrWalletFrozen.
+// Используется операциями пользователя
+func lockActiveWallet(ctx context.Context, tx pgx.Tx, walletUUID string) (storages.Wallet, error) {
+	wallet, err := lockWallet(ctx, tx, walletUUID)
+	if err != nil {
+		return storages.Wallet{}, err
+	}
+	if wallet.Frozen {
+		return storages.Wallet{}, storages.ErrWalletFrozen
+	}
+	return wallet, nil
+}
+
+// Deposit пополнение счёта, возвращает кошелёк с новым балансом
+func (p *PSQL) Deposit(ctx context.Context, walletUUID string, currency string, amount decimal.Decimal) (storages.Wallet, error) {
+	const op = "postgres.Deposit"
+
+	if err := checkedAmount(ctx, p.pool, currency, amount); err != nil {
+		return storages.Wallet{}, err
+	}
+
+	var wallet storages.Wallet
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockActiveWallet(ctx, tx, walletUUID)
+		if err != nil {
+			return err
+		}
+
+		balance, err := adjustBalance(ctx, tx, locked.ID, currency, amount)
+		if err != nil {
+			return err
+		}
+		wallet = withBalance(locked, currency, balance)
+
+		transactionID, err := insertTransaction(ctx, tx, storages.Transaction{
+			WalletID:        wallet.ID,
+			Type:            storages.TransactionDeposit,
+			ToCurrency:      currency,
+			ToAmount:        nullDecimal(amount),
+			ToBalanceBefore: nullDecimal(balanceOf(locked, currency)),
+			ToBalanceAfter:  nullDecimal(balanceOf(wallet, currency)),
+		})
+		if err != nil {
+			return err
+		}
+
+		return postJournal(ctx, tx, movement(currency, amount, accountCashIn, walletAccount(wallet.UUID), transactionID)...)
+	})
+	if err != nil {
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+// Withdraw снятие со счёта, при нехватке средств возвращает storages.ErrInsufficientFunds
+func (p *PSQL) Withdraw(ctx context.Context, walletUUID string, currency string, amount decimal.Decimal) (storages.Wallet, error) {
+	const op = "postgres.Withdraw"
+
+	if err := checkedAmount(ctx, p.pool, currency, amount); err != nil {
+		return storages.Wallet{}, err
+	}
+
+	var wallet storages.Wallet
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockActiveWallet(ctx, tx, walletUUID)
+		if err != nil {
+			return err
+		}
+
+		if balanceOf(locked, currency).LessThan(amount) {
+			return storages.ErrInsufficientFunds
+		}
+
+		balance, err := adjustBalance(ctx, tx, locked.ID, currency, amount.Neg())
+		if err != nil {
+			return err
+		}
+		wallet = withBalance(locked, currency, balance)
+
+		transactionID, err := insertTransaction(ctx, tx, storages.Transaction{
+			WalletID:          wallet.ID,
+			Type:              storages.TransactionWithdraw,
+			FromCurrency:      currency,
+			FromAmount:        nullDecimal(amount),
+			FromBalanceBefore: nullDecimal(balanceOf(locked, currency)),
+			FromBalanceAfter:  nullDecimal(balanceOf(wallet, currency)),
+		})
+		if err != nil {
+			return err
+		}
+
+		return postJournal(ctx, tx, movement(currency, amount, walletAccount(wallet.UUID), accountCashOut, transactionID)...)
+	})
+	if err != nil {
+		return storages.Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+// convertAmount проверяет параметры обмена и считает зачисляемую сумму: amount*rate,
+// округлённую до знаков целевой валюты в режиме money.ConversionRounding
+func convertAmount(ctx context.Context, q querier, exchanger storages.Exchanger, rate decimal.Decimal) (decimal.Decimal, error) {
+	if exchanger.FromCurrency == exchanger.ToCurrency {
+		return decimal.Zero, storages.ErrSameCurrency
+	}
+	if err := checkedAmount(ctx, q, exchanger.FromCurrency, exchanger.Amount); err != nil {
+		return decimal.Zero, err
+	}
+	toScale, err := currencyScale(ctx, q, exchanger.ToCurrency)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !rate.IsPositive() {
+		return decimal.Zero, storages.ErrInvalidRate
+	}
+
+	converted := money.Convert(exchanger.Amount, rate, toScale, money.ConversionRounding)
+	if !converted.IsPositive() {
+		return decimal.Zero, storages.ErrInvalidAmount
+	}
+	return converted, nil
+}
+
+// exchangeLocked проводит обмен по заблокированному кошельку: меняет балансы, пишет историю и журнал.
+// Возвращает кошелёк с новым балансом и id записи в истории
+func exchangeLocked(ctx context.Context, tx pgx.Tx, locked storages.Wallet, exchanger storages.Exchanger,
+	converted, rate decimal.Decimal) (storages.Wallet, int64, error) {
+	if balanceOf(locked, exchanger.FromCurrency).LessThan(exchanger.Amount) {
+		return storages.Wallet{}, 0, storages.ErrInsufficientFunds
+	}
+
+	fromBalance, err := adjustBalance(ctx, tx, locked.ID, exchanger.FromCurrency, exchanger.Amount.Neg())
+	if err != nil {
+		return storages.Wallet{}, 0, err
+	}
+	toBalance, err := adjustBalance(ctx, tx, locked.ID, exchanger.ToCurrency, converted)
+	if err != nil {
+		return storages.Wallet{}, 0, err
+	}
+	wallet := withBalance(withBalance(locked, exchanger.FromCurrency, fromBalance), exchanger.ToCurrency, toBalance)
+
+	transactionID, err := insertTransaction(ctx, tx, storages.Transaction{
+		WalletID:          wallet.ID,
+		Type:              storages.TransactionExchange,
+		FromCurrency:      exchanger.FromCurrency,
+		FromAmount:        nullDecimal(exchanger.Amount),
+		FromBalanceBefore: nullDecimal(balanceOf(locked, exchanger.FromCurrency)),
+		FromBalanceAfter:  nullDecimal(balanceOf(wallet, exchanger.FromCurrency)),
+		ToCurrency:        exchanger.ToCurrency,
+		ToAmount:          nullDecimal(converted),
+		ToBalanceBefore:   nullDecimal(balanceOf(locked, exchanger.ToCurrency)),
+		ToBalanceAfter:    nullDecimal(balanceOf(wallet, exchanger.ToCurrency)),
+		Rate:              nullDecimal(rate),
+	})
+	if err != nil {
+		return storages.Wallet{}, 0, err
+	}
+
+	// Исходная валюта уходит на счёт конвертации, целевая приходит с него
+	account := walletAccount(wallet.UUID)
+	entries := append(
+		movement(exchanger.FromCurrency, exchanger.Amount, account, accountFX, transactionID),
+		movement(exchanger.ToCurrency, converted, accountFX, account, transactionID)...,
+	)
+	if err := postJournal(ctx, tx, entries...); err != nil {
+		return storages.Wallet{}, 0, err
+	}
+
+	return wallet, transactionID, nil
+}
+
+// Exchange списание exchanger.Amount в исходной валюте и зачисление amount*rate в целевой одной транзакцией.
+// Зачисляемая сумма округляется до знаков целевой валюты в режиме money.ConversionRounding.
+// Возвращает кошелёк с новым балансом и зачисленную сумму
+func (p *PSQL) Exchange(ctx context.Context, walletUUID string, exchanger storages.Exchanger, rate decimal.Decimal) (storages.Wallet, decimal.Decimal, error) {
+	const op = "postgres.Exchange"
+
+	converted, err := convertAmount(ctx, p.pool, exchanger, rate)
+	if err != nil {
+		return storages.Wallet{}, decimal.Zero, err
+	}
+
+	var wallet storages.Wallet
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		locked, err := lockActiveWallet(ctx, tx, walletUUID)
+		if err != nil {
+			return err
+		}
+
+		wallet, _, err = exchangeLocked(ctx, tx, locked, exchanger, converted, rate)
+		return err
+	})
+	if err != nil {
+		return storages.Wallet{}, decimal.Zero, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, converted, nil
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gw-currency-wallet/internal/storages"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testDatabaseEnv строка подключения к тестовой БД. Без неё тесты с PostgreSQL пропускаются.
+// Миграции применяются к этой БД, поэтому рабочую базу указывать нельзя
+const testDatabaseEnv = "TEST_DATABASE_URL"
+
+// newTestPSQL подключается к тестовой БД и применяет миграции
+func newTestPSQL(t *testing.T) *PSQL {
+	t.Helper()
+
+	dbURL := os.Getenv(testDatabaseEnv)
+	if dbURL == "" {
+		t.Skipf("%s не задан", testDatabaseEnv)
+	}
+
+	if err := doMigrate(dbURL, "../migrations"); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		t.Fatalf("parse %s: %v", testDatabaseEnv, err)
+	}
+	poolConfig.MaxConns = 20
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return &PSQL{pool: pool, timeout: 10 * time.Second, logger: zap.NewNop()}
+}
+
+// TestWithdrawConcurrent параллельные снятия с одного кошелька: баланс никогда не уходит в минус,
+// а итоговый баланс сходится с числом успешных снятий
+func TestWithdrawConcurrent(t *testing.T) {
+	p := newTestPSQL(t)
+	ctx := context.Background()
+
+	const (
+		currency    = "USD"
+		withdrawals = 300
+	)
+	var (
+		initial = decimal.RequireFromString("100.00")
+		amount  = decimal.RequireFromString("1.00")
+	)
+
+	walletUUID := uuid.NewString()
+	if err := p.CreateWallet(ctx, storages.Wallet{UUID: walletUUID}); err != nil {
+		t.Fatalf("create wallet: %v", err)
+	}
+	if _, err := p.Deposit(ctx, walletUUID, currency, initial); err != nil {
+		t.Fatalf("deposit: %v", err)
+	}
+
+	var (
+		succeeded    atomic.Int64
+		insufficient atomic.Int64
+		wg           sync.WaitGroup
+		start        = make(chan struct{})
+		errs         = make(chan error, withdrawals)
+	)
+	for range withdrawals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			wallet, err := p.Withdraw(ctx, walletUUID, currency, amount)
+			switch {
+			case errors.Is(err, storages.ErrInsufficientFunds):
+				insufficient.Add(1)
+			case err != nil:
+				errs <- err
+			default:
+				succeeded.Add(1)
+				if balance := wallet.Balance[currency]; balance.IsNegative() {
+					errs <- errors.New("negative balance after withdraw: " + balance.String())
+				}
+			}
+		}()
+	}
+
+	// Пока идут снятия, баланс читается отдельным соединением и не должен становиться отрицательным
+	done := make(chan struct{})
+	watcher := make(chan error, 1)
+	go func() {
+		defer close(watcher)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			wallet, err := p.GetWallet(ctx, walletUUID)
+			if err != nil {
+				watcher <- err
+				return
+			}
+			if balance := wallet.Balance[currency]; balance.IsNegative() {
+				watcher <- errors.New("negative balance observed: " + balance.String())
+				return
+			}
+		}
+	}()
+
+	close(start)
+	wg.Wait()
+	close(done)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("withdraw: %v", err)
+	}
+	if err := <-watcher; err != nil {
+		t.Errorf("watch balance: %v", err)
+	}
+
+	wallet, err := p.GetWallet(ctx, walletUUID)
+	if err != nil {
+		t.Fatalf("get wallet: %v", err)
+	}
+
+	ok, failed := succeeded.Load(), insufficient.Load()
+	want := initial.Sub(amount.Mul(decimal.NewFromInt(ok)))
+	if got := wallet.Balance[currency]; !got.Equal(want) {
+		t.Errorf("balance = %s, want %s (initial %s - %d successful withdrawals)", got, want, initial, ok)
+	}
+	if ok+failed != withdrawals {
+		t.Errorf("successful %d + insufficient funds %d != %d withdrawals", ok, failed, withdrawals)
+	}
+	if wantOK := initial.Div(amount).IntPart(); ok != wantOK {
+		t.Errorf("successful withdrawals = %d, want %d", ok, wantOK)
+	}
+	if wantFailed := withdrawals - initial.Div(amount).IntPart(); failed != wantFailed {
+		t.Errorf("insufficient funds errors = %d, want %d", failed, wantFailed)
+	}
+}
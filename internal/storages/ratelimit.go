@@ -0,0 +1,57 @@
+package storages
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket состояние корзины ограничения частоты запросов: остаток токенов на момент UpdatedAt
+type TokenBucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// RateLimitResult результат попытки взять токен. Remaining - сколько запросов ещё можно сделать сразу,
+// RetryAfter - через сколько появится следующий токен (для отклонённого запроса),
+// ResetAfter - через сколько корзина наполнится полностью
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// Take пополняет корзину вместимостью burst (один токен за interval) на момент now и берёт из неё токен.
+// Пустая корзина (нулевое значение) считается полной. Возвращает новое состояние корзины
+func (b TokenBucket) Take(now time.Time, burst int, interval time.Duration) (TokenBucket, RateLimitResult) {
+	capacity := float64(burst)
+	tokens := capacity
+	if !b.UpdatedAt.IsZero() {
+		elapsed := now.Sub(b.UpdatedAt)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(capacity, b.Tokens+float64(elapsed)/float64(interval))
+	}
+
+	res := RateLimitResult{Limit: burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - tokens) * float64(interval))
+	}
+	res.Remaining = int(math.Floor(tokens))
+	res.ResetAfter = time.Duration((capacity - tokens) * float64(interval))
+
+	return TokenBucket{Tokens: tokens, UpdatedAt: now}, res
+}
+
+// LoginAttempts неудачные попытки входа по имени пользователя. Попытка считается неудачной с момента,
+// когда она принята, и забывается после успешного входа. BlockedUntil - до какого момента следующая попытка не принимается
+type LoginAttempts struct {
+	Failures     int
+	LastFailedAt time.Time
+	BlockedUntil time.Time
+}
@@ -0,0 +1,54 @@
+package storages
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	const (
+		burst    = 3
+		interval = time.Second
+	)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Пустая корзина считается полной
+	b, res := TokenBucket{}.Take(start, burst, interval)
+	if !res.Allowed || res.Remaining != 2 || res.Limit != burst || res.ResetAfter != interval {
+		t.Fatalf("first take = %+v, want allowed with 2 remaining and reset after %v", res, interval)
+	}
+
+	b, _ = b.Take(start, burst, interval)
+	b, res = b.Take(start, burst, interval)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("third take = %+v, want allowed with 0 remaining", res)
+	}
+
+	_, res = b.Take(start, burst, interval)
+	if res.Allowed || res.RetryAfter != interval || res.ResetAfter != burst*interval {
+		t.Fatalf("take from empty bucket = %+v, want denied, retry after %v", res, interval)
+	}
+
+	// Через половину интервала накопилась половина токена - ждать ещё половину
+	_, res = b.Take(start.Add(interval/2), burst, interval)
+	if res.Allowed || res.RetryAfter != interval/2 {
+		t.Fatalf("take after half interval = %+v, want denied, retry after %v", res, interval/2)
+	}
+
+	_, res = b.Take(start.Add(interval), burst, interval)
+	if !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("take after interval = %+v, want allowed", res)
+	}
+
+	// Корзина не наполняется больше вместимости
+	_, res = b.Take(start.Add(time.Hour), burst, interval)
+	if !res.Allowed || res.Remaining != burst-1 {
+		t.Fatalf("take after long pause = %+v, want allowed with %d remaining", res, burst-1)
+	}
+
+	// Время, ушедшее назад, не добавляет токенов
+	_, res = b.Take(start.Add(-time.Hour), burst, interval)
+	if res.Allowed {
+		t.Fatalf("take with clock going back = %+v, want denied", res)
+	}
+}
@@ -1,22 +1,94 @@
 package storages
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
 
 type Storage interface {
 	//User methods
-	RegisterUser(ctx context.Context, user User) error
-	//GetUser(ctx context.Context, id string) (User, error)
+	RegisterUser(ctx context.Context, user User) (int, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	GetUserByID(ctx context.Context, userID int) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	UpdateUserPassword(ctx context.Context, userID int, passwordHash string) error
+
+	//Account token methods
+	//Токены из писем одноразовые, хранятся только их хеши
+	CreateUserToken(ctx context.Context, userID int, purpose, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash string) (int, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error)
+
+	//Session methods
+	CreateSession(ctx context.Context, session Session, refresh RefreshToken) error
+	RotateRefreshToken(ctx context.Context, refreshHash string, next RefreshToken) (User, Session, error)
+	ListSessions(ctx context.Context, userID int) ([]Session, error)
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+
+	//MFA methods
+	//Коды TOTP проверяет вызывающая сторона, хранилище принимает шаг кода условно: повтор шага отклоняется
+	GetTOTP(ctx context.Context, userID int) (TOTP, error)
+	EnrollTOTP(ctx context.Context, userID int, secret string) error
+	ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryHashes []string) error
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	CreateMFAChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (int, error)
+	FailMFAChallenge(ctx context.Context, tokenHash string) error
+	CompleteMFAChallenge(ctx context.Context, tokenHash string) (User, error)
+
+	//Currency methods
+	ListCurrencies(ctx context.Context) ([]Currency, error)
 
 	//Wallet methods
+	//Кошелёк задаётся UUID из access-токена
 	CreateWallet(ctx context.Context, wallet Wallet) error
-	GetWalletByUsername(ctx context.Context, username string) (Wallet, error)
-	GetBalance(ctx context.Context, user User) (Wallet, error)
+	GetWallet(ctx context.Context, walletUUID string) (Wallet, error)
 
 	//Deposit/Withdraw methods
-	Deposit(ctx context.Context, wallet Wallet, currency string, amount float64) error
-	Withdraw(ctx context.Context, wallet Wallet, currency string, amount float64) error
+	//Проверка средств и изменение баланса выполняются в одной транзакции с блокировкой строки кошелька
+	Deposit(ctx context.Context, walletUUID string, currency string, amount decimal.Decimal) (Wallet, error)
+	Withdraw(ctx context.Context, walletUUID string, currency string, amount decimal.Decimal) (Wallet, error)
 
 	//Exchange method
-	//Exchange(ctx context.Context, wallet Wallet, exchanger Exchanger) (Wallet, error)
-	UpdateWalletBalance(ctx context.Context, wallet Wallet) error
+	Exchange(ctx context.Context, walletUUID string, exchanger Exchanger, rate decimal.Decimal) (Wallet, decimal.Decimal, error)
+
+	//Quote methods
+	CreateQuote(ctx context.Context, walletUUID string, exchanger Exchanger, rate decimal.Decimal, ttl time.Duration) (Quote, error)
+	ExchangeByQuote(ctx context.Context, walletUUID string, quoteID string) (Wallet, Quote, error)
+
+	//Transfer method
+	Transfer(ctx context.Context, walletUUID string, transfer Transfer) (Wallet, error)
+
+	//Transaction history methods
+	ListTransactions(ctx context.Context, walletUUID string, filter TransactionFilter) ([]Transaction, error)
+
+	//Admin methods
+	//Изменения записываются в журнал аудита в той же транзакции
+	SearchUsers(ctx context.Context, filter UserFilter) ([]UserSummary, error)
+	SetUserRole(ctx context.Context, userID int, role string, audit AuditEntry) error
+	SetWalletFrozen(ctx context.Context, walletUUID string, frozen bool, audit AuditEntry) (Wallet, error)
+	AdjustWallet(ctx context.Context, walletUUID string, adjustment Adjustment, audit AuditEntry) (Wallet, error)
+	RecordAudit(ctx context.Context, entry AuditEntry) error
+	ListAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+
+	//Rate limit methods
+	//Корзины токенов и неудачные попытки входа, общие для всех экземпляров сервиса
+	TakeRateLimitToken(ctx context.Context, key string, burst int, interval time.Duration) (RateLimitResult, error)
+	PurgeRateLimits(ctx context.Context, olderThan, loginWindow time.Duration) error
+	RecordLoginAttempt(ctx context.Context, key string, window time.Duration, delays []time.Duration) (LoginAttempts, bool, error)
+	ResetLoginFailures(ctx context.Context, key string) error
+
+	//Metrics methods
+	//Агрегаты для бизнес-метрик: запросы тяжёлые, вызываются по таймеру, а не на каждый сбор метрик
+	BalanceTotals(ctx context.Context) ([]BalanceTotal, error)
+
+	//Idempotency methods
+	ReserveIdempotencyKey(ctx context.Context, owner, key, requestHash string, ttl time.Duration) (IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, owner, key string, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, owner, key string) error
+	PurgeIdempotencyKeys(ctx context.Context) error
 }
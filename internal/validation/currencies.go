@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"context"
+	"gw-currency-wallet/internal/storages"
+	"sync"
+	"time"
+)
+
+// loadTimeout сколько ждать справочник валют при проверке запроса
+const loadTimeout = 2 * time.Second
+
+// CurrencySource источник справочника валют
+type CurrencySource interface {
+	ListCurrencies(ctx context.Context) ([]storages.Currency, error)
+}
+
+// Currencies справочник валют в памяти. Меняется редко, поэтому перечитывается не чаще раза в ttl.
+// Если перечитать не удалось, используется прежняя копия
+type Currencies struct {
+	source CurrencySource
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	scales   map[string]int32
+	loadedAt time.Time
+}
+
+func NewCurrencies(source CurrencySource, ttl time.Duration) *Currencies {
+	return &Currencies{source: source, ttl: ttl}
+}
+
+// Scale количество знаков валюты. known == false, если валюты нет в справочнике или она отключена
+func (c *Currencies) Scale(code string) (int32, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.scales == nil || time.Since(c.loadedAt) > c.ttl {
+		if err := c.load(); err != nil {
+			if c.scales == nil {
+				return 0, false, err
+			}
+			// Следующая попытка не раньше чем через ttl, чтобы не ждать недоступную БД в каждом запросе
+			c.loadedAt = time.Now()
+		}
+	}
+
+	scale, known := c.scales[code]
+	return scale, known, nil
+}
+
+func (c *Currencies) load() error {
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+
+	currencies, err := c.source.ListCurrencies(ctx)
+	if err != nil {
+		return err
+	}
+
+	scales := make(map[string]int32, len(currencies))
+	for _, cur := range currencies {
+		scales[cur.Code] = cur.Scale
+	}
+	c.scales = scales
+	c.loadedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package validation содержит декларативные правила проверки тел запросов. Правила задаются
+// тегами binding у DTO и регистрируются в валидаторе gin, нарушения превращаются в список ошибок по полям.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
+	"gw-currency-wallet/internal/money"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Ограничения на имя пользователя и пароль. bcrypt учитывает только первые 72 байта пароля
+const (
+	usernameMinLen = 3
+	usernameMaxLen = 32
+	passwordMinLen = 8
+	passwordMaxLen = 72
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// CurrencyLookup справочник валют для правил currency и scale.
+// known == false - валюты нет или она отключена; при err правила пропускаются, валюту проверит хранилище
+type CurrencyLookup interface {
+	Scale(code string) (scale int32, known bool, err error)
+}
+
+// FieldError нарушение правила для одного поля запроса
+type FieldError struct {
+	Field   string `json:"field" example:"amount"`
+	Rule    string `json:"rule" example:"positive"`
+	Message string `json:"message" example:"must be greater than zero"`
+}
+
+// Register добавляет правила в валидатор gin. Поля в ошибках называются так же, как в JSON
+func Register(currencies CurrencyLookup) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected validator engine")
+	}
+
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	// Суммы проверяются как строки: нулевая сумма считается незаполненной и не проходит required
+	v.RegisterCustomTypeFunc(func(field reflect.Value) any {
+		d, ok := field.Interface().(decimal.Decimal)
+		if !ok || d.IsZero() {
+			return ""
+		}
+		return d.String()
+	}, decimal.Decimal{})
+
+	rules := map[string]validator.Func{
+		"username":   validUsername,
+		"password":   validPassword,
+		"currency":   validCurrency(currencies),
+		"positive":   validPositive,
+		"max_amount": validMaxAmount,
+		"notblank":   validNotBlank,
+		"scale":      validScale(currencies),
+	}
+	for tag, fn := range rules {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			return fmt.Errorf("register %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+func validUsername(fl validator.FieldLevel) bool {
+	s := fl.Field().String()
+	return len(s) >= usernameMinLen && len(s) <= usernameMaxLen && usernamePattern.MatchString(s)
+}
+
+// validPassword пароль нужной длины, в котором есть и буквы, и цифры
+func validPassword(fl validator.FieldLevel) bool {
+	s := fl.Field().String()
+	if len(s) < passwordMinLen || len(s) > passwordMaxLen {
+		return false
+	}
+
+	var letter, digit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return letter && digit
+}
+
+// validCurrency код валюты из трёх заглавных букв, включённой в справочнике
+func validCurrency(currencies CurrencyLookup) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		code := fl.Field().String()
+		if !currencyPattern.MatchString(code) {
+			return false
+		}
+		if currencies == nil {
+			return true
+		}
+		_, known, err := currencies.Scale(code)
+		return err != nil || known
+	}
+}
+
+func amountOf(fl validator.FieldLevel) (decimal.Decimal, bool) {
+	d, err := decimal.NewFromString(fl.Field().String())
+	return d, err == nil
+}
+
+func validPositive(fl validator.FieldLevel) bool {
+	d, ok := amountOf(fl)
+	return ok && d.IsPositive()
+}
+
+// validMaxAmount сумма по модулю не больше money.MaxAmount: у корректировок баланса она бывает отрицательной
+func validMaxAmount(fl validator.FieldLevel) bool {
+	d, ok := amountOf(fl)
+	return ok && d.Abs().LessThanOrEqual(money.MaxAmount)
+}
+
+// validNotBlank строка содержит что-то кроме пробелов
+func validNotBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+// validScale сумма не точнее минимальной единицы валюты из поля, указанного параметром правила (scale=Currency).
+// Если валюта неизвестна, ошибку вернёт правило currency у её поля
+func validScale(currencies CurrencyLookup) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		d, ok := amountOf(fl)
+		if !ok {
+			return false
+		}
+		if currencies == nil {
+			return true
+		}
+
+		field, kind, _, found := fl.GetStructFieldOKAdvanced2(fl.Parent(), fl.Param())
+		if !found || kind != reflect.String {
+			return true
+		}
+		scale, known, err := currencies.Scale(field.String())
+		if err != nil || !known {
+			return true
+		}
+		return money.FitsScale(d, scale)
+	}
+}
+
+// Errors переводит ошибку валидатора в список нарушений по полям. ok == false, если err не ошибка валидации,
+// например тело запроса не разобралось как JSON
+func Errors(err error) ([]FieldError, bool) {
+	// Значение не того типа JSON ("currency": 5) - тоже ошибка поля, а не неразборчивое тело
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{Field: typeErr.Field, Rule: "type", Message: "must be a " + typeErr.Type.Kind().String()}}, true
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil, false
+	}
+
+	fields := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, FieldError{Field: fe.Field(), Rule: fe.Tag(), Message: message(fe)})
+	}
+	return fields, true
+}
+
+// message текст нарушения для клиента
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "required_without_all":
+		return "is required unless " + snakeCaseList(fe.Param()) + " is set"
+	case "excluded_with":
+		return "must not be set together with " + snakeCaseList(fe.Param())
+	case "notblank":
+		return "must not be blank"
+	case "len":
+		return fmt.Sprintf("must be %s characters long", fe.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "email":
+		return "must be a valid email address"
+	case "uuid":
+		return "must be a valid UUID"
+	case "max":
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "username":
+		return fmt.Sprintf("must be %d-%d characters long and contain only letters, digits, '.', '_' or '-'", usernameMinLen, usernameMaxLen)
+	case "password":
+		return fmt.Sprintf("must be %d-%d characters long and contain both letters and digits", passwordMinLen, passwordMaxLen)
+	case "currency":
+		return "must be a supported currency code"
+	case "nefield":
+		return "must differ from " + snakeCase(fe.Param())
+	case "positive":
+		return "must be greater than zero"
+	case "max_amount":
+		return "must not exceed " + money.MaxAmount.String() + " in absolute value"
+	case "scale":
+		return "has more decimal places than the currency allows"
+	default:
+		return "is invalid"
+	}
+}
+
+// snakeCaseList параметр правила со списком полей Go через пробел в виде "to_email or to_wallet_uuid"
+func snakeCaseList(param string) string {
+	names := strings.Fields(param)
+	for i, name := range names {
+		names[i] = snakeCase(name)
+	}
+	return strings.Join(names, " or ")
+}
+
+// snakeCase имя поля Go в виде ключа JSON: FromCurrency -> from_currency, ToWalletUUID -> to_wallet_uuid
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Аббревиатура пишется слитно, новое слово начинается после строчной буквы или перед ней
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}